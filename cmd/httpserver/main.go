@@ -1,64 +1,91 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/middleware"
 	"httpfromtcp/internal/request"
 	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/router"
 	"httpfromtcp/internal/server"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
+	"strconv"
 	"syscall"
+	"time"
 )
 
 const port = 42069
+const shutdownTimeout = 10 * time.Second
 
 func main() {
-	server, err := server.Serve(port, handler)
+	handler := server.Chain(newRouter().Serve,
+		middleware.Recover(),
+		middleware.Logger(log.Default()),
+		middleware.RequestID(),
+		middleware.Timing(),
+	)
+	server := server.New(handler)
+	server.ReadHeaderTimeout = 5 * time.Second
+	server.ReadTimeout = 30 * time.Second
+	server.WriteTimeout = 30 * time.Second
+	server.IdleTimeout = 60 * time.Second
+	err := server.Listen(port)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
-	log.Println("Server gracefully stopped")
-}
 
-func handler(w *response.Writer, r *request.Request) *server.HandlerError {
-	if r.RequestLine.RequestTarget == "/yourproblem" {
-		write400Response(w)
-		return nil
-	}
-
-	if r.RequestLine.RequestTarget == "/myproblem" {
-		write500Response(w)
-		return nil
-	}
-
-	if strings.HasPrefix(r.RequestLine.RequestTarget, "/httpbin") {
-		writeChunkedResponse(w, strings.TrimPrefix(r.RequestLine.RequestTarget, "/httpbin"))
-		return nil
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	if err != nil {
+		log.Printf("Error shutting down server: %v", err)
+		return
 	}
+	log.Println("Server gracefully stopped")
+}
 
-	if r.RequestLine.Method == "GET" && r.RequestLine.RequestTarget == "/video" {
-		writeVideoFile(w)
-		return nil
+func newRouter() *router.Router {
+	rt := router.New()
+	rt.Get("/yourproblem", func(w *response.Writer, r *request.Request) *server.HandlerError {
+		return badRequestError()
+	})
+	rt.Get("/myproblem", func(w *response.Writer, r *request.Request) *server.HandlerError {
+		return internalServerError()
+	})
+	proxyHttpbin := func(w *response.Writer, r *request.Request) *server.HandlerError {
+		path := "/" + r.Param("path")
+		if r.Target.RawQuery != "" {
+			path += "?" + r.Target.RawQuery
+		}
+		return writeChunkedResponse(w, path)
 	}
-
-	return nil
+	// "/httpbin/{path...}" needs the slash after httpbin, so the bare path
+	// is registered on its own.
+	rt.Get("/httpbin", proxyHttpbin)
+	rt.Get("/httpbin/{path...}", proxyHttpbin)
+	rt.Get("/video", func(w *response.Writer, r *request.Request) *server.HandlerError {
+		return writeVideoFile(w)
+	})
+	rt.Get("/events", func(w *response.Writer, r *request.Request) *server.HandlerError {
+		return writeClockEvents(w)
+	})
+	return rt
 }
 
-func write400Response(w *response.Writer) {
-	body := []byte(`
+func badRequestError() *server.HandlerError {
+	body := `
 		<html>
 		<head>
 			<title>400 Bad Request</title>
@@ -68,19 +95,17 @@ func write400Response(w *response.Writer) {
 			<p>Your request honestly kinda sucked.</p>
 		</body>
 		</html>
-			`)
-
-	w.WriteStatusLine(400)
-
-	headers := response.GetDefaultHeaders(len(body))
-	headers.Override("content-type", "text/html")
+			`
 
-	w.WriteHeaders(headers)
-	w.WriteBody(body)
+	return &server.HandlerError{
+		StatusCode:  response.Code400,
+		Message:     body,
+		ContentType: "text/html",
+	}
 }
 
-func write500Response(w *response.Writer) {
-	body := []byte(`
+func internalServerError() *server.HandlerError {
+	body := `
 	<html>
 		<head>
 			<title>500 Internal Server Error</title>
@@ -90,15 +115,13 @@ func write500Response(w *response.Writer) {
 			<p>Okay, you know what? This one is on me.</p>
 		</body>
 	</html>
-	`)
-
-	w.WriteStatusLine(500)
+	`
 
-	headers := response.GetDefaultHeaders(len(body))
-	headers.Override("content-type", "text/html")
-
-	w.WriteHeaders(headers)
-	w.WriteBody(body)
+	return &server.HandlerError{
+		StatusCode:  response.Code500,
+		Message:     body,
+		ContentType: "text/html",
+	}
 }
 
 func write200Response(w *response.Writer) {
@@ -113,7 +136,7 @@ func write200Response(w *response.Writer) {
 		</body>
 	</html>
 	`)
-	w.WriteStatusLine(200)
+	w.WriteStatusLine(response.Code200)
 
 	headers := response.GetDefaultHeaders(len(body))
 	headers.Override("content-type", "text/html")
@@ -122,59 +145,77 @@ func write200Response(w *response.Writer) {
 	w.WriteBody(body)
 }
 
-func writeChunkedResponse(w *response.Writer, path string) {
+func writeChunkedResponse(w *response.Writer, path string) *server.HandlerError {
 	httpbinRes, err := http.Get("https://httpbin.org" + path)
 	if err != nil {
-		write500Response(w)
+		return internalServerError()
 	}
+	defer httpbinRes.Body.Close()
 
-	err = w.WriteStatusLine(httpbinRes.StatusCode)
+	err = w.WriteStatusLine(response.StatusCode(httpbinRes.StatusCode))
 
 	httpbinRes.Header.Del("content-length")
 	httpbinRes.Header.Add("transfer-encoding", "chunked")
 	httpbinRes.Header.Add("Trailer", "X-Content-SHA256, X-Content-Length")
 	h := headers.NewHeaders()
-	for key, value := range httpbinRes.Header {
-		h[key] = strings.Join(value, ", ")
+	for key, values := range httpbinRes.Header {
+		for _, value := range values {
+			h.Add(key, value)
+		}
 	}
 	w.WriteHeaders(h)
 
-	buf := make([]byte, 1024)
-	body := []byte{}
-
-	for {
-		n, err := httpbinRes.Body.Read(buf)
-		if err != nil {
-			if err == io.EOF {
-				break
-			} else {
-				// TODO: Implement
-			}
-		}
-
-		body = append(body, buf[:n]...)
-		_, err = w.WriteChunkedBody(buf)
+	hash := sha256.New()
+	n, err := w.Stream(io.TeeReader(httpbinRes.Body, hash), 100*time.Millisecond)
+	if err != nil {
+		log.Printf("error streaming httpbin response: %s", err)
+		return nil
 	}
 
 	w.WriteChunkedBodyDone()
 	t := headers.NewHeaders()
-	t["X-Content-Length"] = fmt.Sprintf("%d", len(body))
-	sum := sha256.Sum256(body)
-	hash := sum[:]
-	t["X-Content-Sha256"] = hex.EncodeToString(hash)
+	t.Set("X-Content-Length", fmt.Sprintf("%d", n))
+	t.Set("X-Content-Sha256", hex.EncodeToString(hash.Sum(nil)))
 	w.WriteTrailers(t)
+	return nil
 }
 
-func writeVideoFile(w *response.Writer) {
-	file, err := os.ReadFile("/home/rahulc/bootdev/httpfromtcp/assets/vim.mp4")
+func writeClockEvents(w *response.Writer) *server.HandlerError {
+	events, err := response.NewEventStream(w, 15*time.Second)
 	if err != nil {
+		return internalServerError()
+	}
+	defer events.Close()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for id := 1; ; id++ {
+		select {
+		case <-events.Done():
+			return nil
+		case now := <-ticker.C:
+			err = events.Send(response.Event{
+				ID:    strconv.Itoa(id),
+				Event: "tick",
+				Data:  now.Format(time.RFC3339),
+			})
+			if err != nil {
+				return nil
+			}
+		}
+	}
+}
 
-		write500Response(w)
+func writeVideoFile(w *response.Writer) *server.HandlerError {
+	file, err := os.ReadFile("/home/rahulc/bootdev/httpfromtcp/assets/vim.mp4")
+	if err != nil {
+		return internalServerError()
 	}
 
-	w.WriteStatusLine(200)
+	w.WriteStatusLine(response.Code200)
 	h := response.GetDefaultHeaders(len(file))
 	h.Override("Content-Type", "video/mp4")
 	w.WriteHeaders(h)
 	w.WriteBody(file)
+	return nil
 }
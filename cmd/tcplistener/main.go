@@ -34,8 +34,8 @@ func main() {
 		fmt.Printf("- Target: %s\n", req.RequestLine.RequestTarget)
 		fmt.Printf("- Version: %s\n", req.RequestLine.HttpVersion)
 		fmt.Println("Headers:")
-		for key, value := range req.Headers {
-			fmt.Printf("- %s: %s\n", key, value)
+		for _, field := range req.Headers.Fields() {
+			fmt.Printf("- %s: %s\n", field.Name, field.Value)
 		}
 		fmt.Println("Body:")
 		fmt.Println(string(req.Body))
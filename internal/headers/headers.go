@@ -3,24 +3,142 @@ package headers
 import (
 	"bytes"
 	"fmt"
+	"slices"
 	"strings"
 )
 
 const crlf = "\r\n"
 
-type Headers map[string]string
+// ParseError is an error in a message caused by the peer, with the status
+// code a server should answer it with. The request package uses it for its
+// own errors too, so one errors.As finds the status of any parse error.
+type ParseError struct {
+	Status  int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return e.Message
+}
+
+func (e *ParseError) StatusCode() int {
+	return e.Status
+}
+
+var (
+	ErrFieldsTooLarge     = &ParseError{Status: 431, Message: "error: header fields exceed size limit"}
+	ErrTooManyFields      = &ParseError{Status: 431, Message: "error: too many header fields"}
+	ErrMalformedFieldLine = &ParseError{Status: 400, Message: "error: malformed header field line"}
+	ErrInvalidFieldName   = &ParseError{Status: 400, Message: "error: invalid header field name"}
+	ErrInvalidFieldValue  = &ParseError{Status: 400, Message: "error: invalid header field value"}
+)
+
+// FieldError reports a header field that failed validation. Err is
+// ErrInvalidFieldName or ErrInvalidFieldValue.
+type FieldError struct {
+	Name string
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %q", e.Err, e.Name)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Field is a single header field line, with the name as it was received or
+// added.
+type Field struct {
+	Name  string
+	Value string
+}
 
-func NewHeaders() Headers {
-	return make(Headers)
+// Headers is an ordered list of header fields. Names keep their original
+// case but are matched case-insensitively.
+type Headers struct {
+	fields []Field
 }
 
-func (h Headers) Get(key string) (string, bool) {
-	key = strings.ToLower(key)
-	value, ok := h[key]
-	return value, ok
+func NewHeaders() *Headers {
+	return &Headers{}
+}
+
+// Get returns the values of every field named key, joined with ", " as if
+// they had been sent on one line. Use Values for fields such as Set-Cookie
+// that cannot be combined.
+func (h *Headers) Get(key string) (string, bool) {
+	values := h.Values(key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return strings.Join(values, ", "), true
+}
+
+// Values returns the values of every field named key in order.
+func (h *Headers) Values(key string) []string {
+	var values []string
+	for _, field := range h.fields {
+		if strings.EqualFold(field.Name, key) {
+			values = append(values, field.Value)
+		}
+	}
+	return values
+}
+
+// Add appends a field, keeping any existing fields with the same name.
+func (h *Headers) Add(key, value string) {
+	h.fields = append(h.fields, Field{Name: key, Value: value})
+}
+
+// Set replaces the fields named key with a single field. The field keeps the
+// position of the first one it replaces, or is appended if there was none.
+func (h *Headers) Set(key, value string) {
+	replaced := false
+	fields := h.fields[:0]
+	for _, field := range h.fields {
+		if !strings.EqualFold(field.Name, key) {
+			fields = append(fields, field)
+			continue
+		}
+		if !replaced {
+			fields = append(fields, Field{Name: key, Value: value})
+			replaced = true
+		}
+	}
+	h.fields = fields
+
+	if !replaced {
+		h.Add(key, value)
+	}
 }
 
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
+// Del removes every field named key.
+func (h *Headers) Del(key string) {
+	fields := h.fields[:0]
+	for _, field := range h.fields {
+		if !strings.EqualFold(field.Name, key) {
+			fields = append(fields, field)
+		}
+	}
+	h.fields = fields
+}
+
+func (h *Headers) Len() int {
+	return len(h.fields)
+}
+
+// Fields returns a copy of the fields in order.
+func (h *Headers) Fields() []Field {
+	return slices.Clone(h.fields)
+}
+
+func (h *Headers) Clone() *Headers {
+	return &Headers{fields: slices.Clone(h.fields)}
+}
+
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 	indexCRLF := bytes.Index(data, []byte(crlf))
 	if indexCRLF == -1 {
 		return 0, false, nil
@@ -30,36 +148,71 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 		return len(crlf), true, nil
 	}
 	fieldLine := data[:indexCRLF]
+	// A line starting with whitespace continues the previous field value
+	// (obs-fold, RFC 9112 section 5.2). Reading it as a field of its own
+	// would let it smuggle in a second Host or similar, so it is rejected.
+	if fieldLine[0] == ' ' || fieldLine[0] == '\t' {
+		return 0, false, fmt.Errorf("%w: obsolete line folding: %q", ErrMalformedFieldLine, fieldLine)
+	}
 
 	indexColon := bytes.Index(fieldLine, []byte(":"))
-	fieldKey := strings.TrimLeft(string(data[:indexColon]), " ")
-	fieldKey = strings.ToLower(fieldKey)
-
-	if isKeyValid := validateFieldKey(fieldKey); !isKeyValid {
-		return 0, false, fmt.Errorf("error: field key has invalid characters: %s", fieldKey)
+	if indexColon == -1 {
+		return 0, false, fmt.Errorf("%w: no colon: %q", ErrMalformedFieldLine, fieldLine)
 	}
+	fieldKey := string(fieldLine[:indexColon])
+	fieldValue := strings.Trim(string(fieldLine[indexColon+1:]), " \t")
 
-	fieldValue := strings.TrimSpace(string(fieldLine[indexColon+1:]))
-
-	value, ok := h[fieldKey]
-	if ok {
-		h[fieldKey] = strings.Join([]string{value, fieldValue}, ", ")
-	} else {
-		h[fieldKey] = fieldValue
+	err = ValidateField(fieldKey, fieldValue)
+	if err != nil {
+		return 0, false, err
 	}
+	h.Add(fieldKey, fieldValue)
 
 	return indexCRLF + len(crlf), false, nil
 }
 
-func (h Headers) Override(key, value string) error {
-	key = strings.ToLower(key)
-	if _, ok := h[key]; !ok {
+// HasToken reports whether the comma-separated list value contains token,
+// compared case-insensitively.
+func HasToken(value, token string) bool {
+	for _, t := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Headers) Override(key, value string) error {
+	if _, ok := h.Get(key); !ok {
 		return fmt.Errorf("key does not exist in headers: %s", key)
 	}
-	h[key] = value
+	h.Set(key, value)
+	return nil
+}
+
+// ValidateField checks that name is a token and that value contains no
+// control characters other than horizontal tab, so the field cannot break
+// out of its line. Bytes above 0x7F are accepted as obs-text.
+func ValidateField(name, value string) error {
+	if !validateFieldKey(name) {
+		return &FieldError{Name: name, Err: ErrInvalidFieldName}
+	}
+	if !validateFieldValue(value) {
+		return &FieldError{Name: name, Err: ErrInvalidFieldValue}
+	}
 	return nil
 }
 
+func validateFieldValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
 func validateFieldKey(key string) bool {
 	validChars := map[string]bool{
 		"!": true, "#": true, "$": true, "%": true, "&": true,
@@ -74,7 +227,11 @@ func validateFieldKey(key string) bool {
 		"5": true, "6": true, "7": true, "8": true, "9": true,
 	}
 
-	for _, char := range key {
+	if key == "" {
+		return false
+	}
+
+	for _, char := range strings.ToLower(key) {
 		if _, ok := validChars[string(char)]; !ok {
 			return false
 		}
@@ -14,28 +14,40 @@ func TestSingleHeadersParse(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, []string{"localhost:42069"}, headers.Values("host"))
+	assert.Equal(t, "HOST", headers.Fields()[0].Name)
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
 	// Test: Valid single header with extra whitespace
 	headers = NewHeaders()
-	data = []byte("             HosT:        localhost:42069       \r\n\r\n")
+	data = []byte("HosT:        localhost:42069       \r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
-	assert.Equal(t, 50, n)
+	assert.Equal(t, []string{"localhost:42069"}, headers.Values("host"))
+	assert.Equal(t, 37, n)
 	assert.False(t, done)
 
+	// Test: Leading whitespace is obs-fold and rejected
+	for _, data := range []string{"             HosT: localhost:42069\r\n\r\n", "\tHost: b\r\n\r\n"} {
+		headers = NewHeaders()
+		n, done, err = headers.Parse([]byte(data))
+		require.ErrorIs(t, err, ErrMalformedFieldLine)
+		assert.Equal(t, 0, n)
+		assert.False(t, done)
+		assert.Equal(t, 0, headers.Len())
+	}
+
 	// Test: Valid 2 headers with existing headers
-	headers = map[string]string{"host": "localhost:42069"}
+	headers = NewHeaders()
+	headers.Add("Host", "localhost:42069")
 	data = []byte("User-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
-	assert.Equal(t, "curl/7.81.0", headers["user-agent"])
+	assert.Equal(t, []string{"localhost:42069"}, headers.Values("host"))
+	assert.Equal(t, []string{"curl/7.81.0"}, headers.Values("user-agent"))
 	assert.Equal(t, 25, n)
 	assert.False(t, done)
 
@@ -65,12 +77,86 @@ func TestSingleHeadersParse(t *testing.T) {
 	assert.False(t, done)
 
 	// Test: Valid already existing header key
-	headers = map[string]string{"host": "localhost:42069"}
+	headers = NewHeaders()
+	headers.Add("host", "localhost:42069")
 	data = []byte("host: localhost:69420\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.Equal(t, 23, n)
-	assert.Equal(t, "localhost:42069, localhost:69420", headers["host"])
+	assert.Equal(t, []string{"localhost:42069", "localhost:69420"}, headers.Values("host"))
+	value, ok := headers.Get("Host")
+	require.True(t, ok)
+	assert.Equal(t, "localhost:42069, localhost:69420", value)
 	assert.Equal(t, len("host: localhost:69420\r\n"), n)
 	assert.False(t, done)
 }
+
+func TestHeadersFields(t *testing.T) {
+	// Test: Insertion order and original case are preserved
+	headers := NewHeaders()
+	headers.Add("Content-Type", "text/plain")
+	headers.Add("Set-Cookie", "a=1")
+	headers.Add("set-cookie", "b=2")
+	assert.Equal(t, []Field{
+		{Name: "Content-Type", Value: "text/plain"},
+		{Name: "Set-Cookie", Value: "a=1"},
+		{Name: "set-cookie", Value: "b=2"},
+	}, headers.Fields())
+	assert.Equal(t, []string{"a=1", "b=2"}, headers.Values("SET-COOKIE"))
+
+	// Test: Set replaces every field in place of the first
+	headers.Add("X-Trace", "1")
+	headers.Set("set-cookie", "c=3")
+	assert.Equal(t, []Field{
+		{Name: "Content-Type", Value: "text/plain"},
+		{Name: "set-cookie", Value: "c=3"},
+		{Name: "X-Trace", Value: "1"},
+	}, headers.Fields())
+
+	// Test: Set appends a missing field
+	headers.Set("Content-Length", "0")
+	assert.Equal(t, 4, headers.Len())
+
+	// Test: Del removes case-insensitively
+	headers.Del("CONTENT-TYPE")
+	_, ok := headers.Get("content-type")
+	assert.False(t, ok)
+	assert.Equal(t, 3, headers.Len())
+
+	// Test: Missing colon
+	headers = NewHeaders()
+	n, done, err := headers.Parse([]byte("Host localhost\r\n\r\n"))
+	require.Error(t, err)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+}
+
+func TestFieldValueValidation(t *testing.T) {
+	// Test: Bare CR in value
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("X-Test: a\rb\r\n\r\n"))
+	require.ErrorIs(t, err, ErrInvalidFieldValue)
+
+	// Test: NUL in value
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("X-Test: a\x00b\r\n\r\n"))
+	require.ErrorIs(t, err, ErrInvalidFieldValue)
+	var fieldErr *FieldError
+	require.ErrorAs(t, err, &fieldErr)
+	assert.Equal(t, "X-Test", fieldErr.Name)
+
+	// Test: Tab and obs-text are allowed
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("X-Test: a\tb \xe9\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a\tb \xe9"}, headers.Values("x-test"))
+
+	// Test: Invalid name is a typed error
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("X@Test: a\r\n\r\n"))
+	require.ErrorIs(t, err, ErrInvalidFieldName)
+
+	// Test: Validating values before writing
+	require.ErrorIs(t, ValidateField("Location", "/a\r\nSet-Cookie: x=1"), ErrInvalidFieldValue)
+	require.NoError(t, ValidateField("Location", "/a"))
+}
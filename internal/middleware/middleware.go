@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+// Recover turns a panic in the wrapped handler into a 500 HandlerError and
+// logs the stack. If the response was already started the server closes the
+// connection instead of writing the error.
+func Recover() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) (handlerErr *server.HandlerError) {
+			defer func() {
+				if v := recover(); v != nil {
+					log.Printf("panic serving %s %s: %v\n%s", req.RequestLine.Method, req.RequestLine.RequestTarget, v, debug.Stack())
+					handlerErr = server.NewHandlerError(response.Code500, "internal server error")
+				}
+			}()
+			return next(w, req)
+		}
+	}
+}
+
+// Logger logs the method, target, status, body size and duration of every
+// request once the server has finished its response, so bodies buffered by
+// Write and error responses are counted. A response the server abandons,
+// because the handler failed or panicked after its headers were sent, is
+// logged as far as it got.
+func Logger(logger *log.Logger) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) *server.HandlerError {
+			start := time.Now()
+			logRequest := func() {
+				logger.Printf("%s %s %d %dB %s", req.RequestLine.Method, req.RequestLine.RequestTarget, w.StatusCode(), w.BodyBytesWritten(), time.Since(start))
+			}
+			w.OnFinish(logRequest)
+
+			returned := false
+			defer func() {
+				if !returned && w.HeadersSent() {
+					logRequest()
+				}
+			}()
+			handlerErr := next(w, req)
+			returned = true
+			if handlerErr != nil && w.HeadersSent() {
+				logRequest()
+			}
+			return handlerErr
+		}
+	}
+}
+
+// RequestID gives every request an ID, reusing the client's X-Request-Id if
+// it sent one. The ID is stored in the request headers for handlers to read
+// and echoed in the response headers.
+func RequestID() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) *server.HandlerError {
+			id, ok := req.Headers.Get(requestIDHeader)
+			if !ok || id == "" {
+				id = newRequestID()
+				req.Headers.Set(requestIDHeader, id)
+			}
+
+			w.OnHeaders(func(h *headers.Headers) {
+				h.Set(requestIDHeader, id)
+			})
+			return next(w, req)
+		}
+	}
+}
+
+// Timing adds an X-Response-Time header with the time the handler took to
+// produce its headers.
+func Timing() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) *server.HandlerError {
+			start := time.Now()
+			w.OnHeaders(func(h *headers.Headers) {
+				h.Set("X-Response-Time", fmt.Sprintf("%.3fms", float64(time.Since(start).Microseconds())/1000))
+			})
+			return next(w, req)
+		}
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
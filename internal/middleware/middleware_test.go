@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"bytes"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainOrder(t *testing.T) {
+	order := []string{}
+	record := func(name string) server.Middleware {
+		return func(next server.Handler) server.Handler {
+			return func(w *response.Writer, req *request.Request) *server.HandlerError {
+				order = append(order, name)
+				return next(w, req)
+			}
+		}
+	}
+
+	handler := server.Chain(func(w *response.Writer, req *request.Request) *server.HandlerError {
+		order = append(order, "handler")
+		return nil
+	}, record("first"), server.Compose(record("second"), record("third")))
+
+	handlerErr := handler(response.NewWriter(&bytes.Buffer{}), newRequest())
+	require.Nil(t, handlerErr)
+	assert.Equal(t, []string{"first", "second", "third", "handler"}, order)
+}
+
+func TestRecover(t *testing.T) {
+	handler := server.Chain(func(w *response.Writer, req *request.Request) *server.HandlerError {
+		panic("boom")
+	}, Recover())
+
+	handlerErr := handler(response.NewWriter(&bytes.Buffer{}), newRequest())
+	require.NotNil(t, handlerErr)
+	assert.Equal(t, response.Code500, handlerErr.Status())
+}
+
+func TestRequestIDAndLogger(t *testing.T) {
+	logs := &bytes.Buffer{}
+	handler := server.Chain(func(w *response.Writer, req *request.Request) *server.HandlerError {
+		body := []byte("hello")
+		w.WriteStatusLine(200)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+		return nil
+	}, Logger(log.New(logs, "", 0)), RequestID())
+
+	// Test: Client supplied request ID is echoed
+	buf := &bytes.Buffer{}
+	req := newRequest()
+	req.Headers.Set("X-Request-Id", "abc")
+	w := response.NewWriter(buf)
+	handlerErr := handler(w, req)
+	require.Nil(t, handlerErr)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "X-Request-Id: abc\r\n")
+	assert.True(t, strings.HasPrefix(logs.String(), "GET / 200 5B "))
+
+	// Test: Missing request ID is generated
+	buf = &bytes.Buffer{}
+	req = newRequest()
+	handlerErr = handler(response.NewWriter(buf), req)
+	require.Nil(t, handlerErr)
+	id, ok := req.Headers.Get("x-request-id")
+	require.True(t, ok)
+	assert.Len(t, id, 16)
+	assert.Contains(t, buf.String(), "X-Request-Id: "+id+"\r\n")
+}
+
+func TestLogger(t *testing.T) {
+	logs := &bytes.Buffer{}
+	handler := server.Chain(func(w *response.Writer, req *request.Request) *server.HandlerError {
+		switch req.RequestLine.RequestTarget {
+		case "/buffered":
+			w.Write([]byte("hello"))
+		case "/error":
+			return server.NewHandlerError(response.Code404, "not found")
+		case "/panic":
+			w.Write([]byte("partial"))
+			w.Flush()
+			panic("boom")
+		}
+		return nil
+	}, Recover(), Logger(log.New(logs, "", 0)))
+
+	// Test: A buffered body is logged once Finish sends it
+	w := response.NewWriter(&bytes.Buffer{})
+	require.Nil(t, handler(w, newRequestTo("/buffered")))
+	assert.Empty(t, logs.String())
+	require.NoError(t, w.Finish())
+	require.NoError(t, w.Finish())
+	assert.Regexp(t, `^GET /buffered 200 5B \S+\n$`, logs.String())
+
+	// Test: A handler that writes nothing is logged with the 200 it gets
+	logs.Reset()
+	w = response.NewWriter(&bytes.Buffer{})
+	require.Nil(t, handler(w, newRequestTo("/")))
+	require.NoError(t, w.Finish())
+	assert.Regexp(t, `^GET / 200 0B `, logs.String())
+
+	// Test: An error response is logged with its status and body once it
+	// is written as the server would
+	logs.Reset()
+	errorBody := "not found"
+	w = response.NewWriter(&bytes.Buffer{})
+	handlerErr := handler(w, newRequestTo("/error"))
+	require.NotNil(t, handlerErr)
+	w.WriteStatusLine(handlerErr.Status())
+	w.WriteHeaders(response.GetDefaultHeaders(len(errorBody)))
+	w.WriteBody([]byte(errorBody))
+	require.NoError(t, w.Finish())
+	assert.Regexp(t, `^GET /error 404 9B `, logs.String())
+
+	// Test: A panic after the headers were sent is still logged
+	logs.Reset()
+	w = response.NewWriter(&bytes.Buffer{})
+	handlerErr = handler(w, newRequestTo("/panic"))
+	require.NotNil(t, handlerErr)
+	assert.Regexp(t, `^GET /panic 200 7B `, logs.String())
+}
+
+func newRequest() *request.Request {
+	return newRequestTo("/")
+}
+
+func newRequestTo(target string) *request.Request {
+	return &request.Request{
+		RequestLine: request.RequestLine{Method: "GET", RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+}
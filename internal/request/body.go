@@ -0,0 +1,107 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// maxDrainBytes is how much of an unread body Close will discard to keep the
+// connection usable for the next request.
+const maxDrainBytes = 256 << 10
+
+var (
+	ErrBodyClosed     = errors.New("error: read on closed request body")
+	ErrBodyNotDrained = errors.New("error: request body too large to drain")
+)
+
+// body streams a request body from the connection, enforcing the framing
+// chosen when the headers were parsed.
+type body struct {
+	reader *Reader
+	req    *Request
+	closed bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBodyClosed
+	}
+
+	for len(b.req.pending) == 0 && b.req.RequestParseState != done {
+		err := b.reader.readMore(b.req)
+		if err != nil {
+			return 0, err
+		}
+		err = b.reader.parseBuffered(b.req)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if len(b.req.pending) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, b.req.pending)
+	b.req.pending = b.req.pending[:copy(b.req.pending, b.req.pending[n:])]
+	return n, nil
+}
+
+// Close discards whatever the handler left unread so the next request on the
+// connection can be parsed. It returns ErrBodyNotDrained if more than
+// maxDrainBytes remained, in which case the connection must not be reused.
+func (b *body) Close() error {
+	if b.closed {
+		return nil
+	}
+
+	n, err := io.CopyN(io.Discard, b, maxDrainBytes+1)
+	b.closed = true
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if n > maxDrainBytes {
+		return ErrBodyNotDrained
+	}
+	return nil
+}
+
+// BodyDrainable reports whether closing BodyReader can discard what is left
+// of the body within maxDrainBytes, so the connection can be reused. A
+// chunked body that has not been read to the end is of unknown size and is
+// reported as not drainable.
+func (r *Request) BodyDrainable() bool {
+	if !r.streamBody {
+		return true
+	}
+	switch r.RequestParseState {
+	case done:
+		return true
+	case parsingBody:
+		chunked, contentLength, err := bodyFraming(r.Headers)
+		return err == nil && !chunked && len(r.pending)+contentLength <= maxDrainBytes
+	case parsingFixedBody:
+		return len(r.pending)+r.bodyRemaining <= maxDrainBytes
+	default:
+		return false
+	}
+}
+
+// ReadBody buffers a streamed body into Body, leaving the request as if it
+// had been parsed by a Reader without StreamBody.
+func (r *Request) ReadBody() error {
+	if !r.streamBody {
+		return nil
+	}
+
+	body, err := io.ReadAll(r.BodyReader)
+	if err != nil {
+		return err
+	}
+
+	r.Body = body
+	r.BodyReader = io.NopCloser(bytes.NewReader(r.Body))
+	r.streamBody = false
+	return nil
+}
@@ -0,0 +1,111 @@
+package request
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func (r *Request) parseChunked(data []byte) (int, error) {
+	switch r.RequestParseState {
+	case parsingChunkSize:
+		indexCRLF := bytes.Index(data, []byte(crlf))
+		if indexCRLF == -1 {
+			if len(data) > maxChunkLineLength {
+				return 0, fmt.Errorf("%w: size line exceeds %d bytes", ErrMalformedChunk, maxChunkLineLength)
+			}
+			return 0, nil
+		}
+		if indexCRLF > maxChunkLineLength {
+			return 0, fmt.Errorf("%w: size line exceeds %d bytes", ErrMalformedChunk, maxChunkLineLength)
+		}
+
+		size, err := parseChunkSize(string(data[:indexCRLF]))
+		if err != nil {
+			return 0, err
+		}
+
+		if size == 0 {
+			r.RequestParseState = parsingTrailers
+		} else {
+			r.bodyRemaining = size
+			r.RequestParseState = parsingChunkData
+		}
+		return indexCRLF + len(crlf), nil
+	case parsingChunkData:
+		n := r.bodyRemaining
+		if n > len(data) {
+			n = len(data)
+		}
+		err := r.appendBody(data[:n])
+		if err != nil {
+			return 0, err
+		}
+		r.bodyRemaining -= n
+
+		if r.bodyRemaining == 0 {
+			r.RequestParseState = parsingChunkDataEnd
+		}
+		return n, nil
+	case parsingChunkDataEnd:
+		if len(data) < len(crlf) {
+			return 0, nil
+		}
+		if !bytes.HasPrefix(data, []byte(crlf)) {
+			return 0, fmt.Errorf("%w: data is not followed by CRLF", ErrMalformedChunk)
+		}
+
+		r.RequestParseState = parsingChunkSize
+		return len(crlf), nil
+	case parsingTrailers:
+		numBytes, isDone, err := r.Trailers.Parse(data)
+		if err != nil {
+			return 0, err
+		}
+		err = r.countHeaderBytes(data, numBytes, isDone)
+		if err != nil {
+			return 0, err
+		}
+
+		if isDone {
+			r.RequestParseState = done
+		}
+		return numBytes, nil
+	default:
+		return 0, fmt.Errorf("error: state is not a chunked body state: %v", r.RequestParseState)
+	}
+}
+
+// parseChunkSize parses a chunk-size line of one or more hex digits,
+// ignoring any chunk extensions.
+func parseChunkSize(line string) (int, error) {
+	sizeStr, extensions, hasExtensions := strings.Cut(line, ";")
+	sizeStr = strings.TrimRight(sizeStr, " \t")
+	if sizeStr == "" {
+		return 0, fmt.Errorf("%w: missing size: %q", ErrMalformedChunk, line)
+	}
+
+	// ParseInt would also accept a sign, which another hop may read
+	// differently, so only bare hex digits are allowed.
+	for i := 0; i < len(sizeStr); i++ {
+		if !isHex(sizeStr[i]) {
+			return 0, fmt.Errorf("%w: invalid size: %q", ErrMalformedChunk, sizeStr)
+		}
+	}
+	size, err := strconv.ParseInt(sizeStr, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid size: %q", ErrMalformedChunk, sizeStr)
+	}
+
+	if hasExtensions {
+		for _, extension := range strings.Split(extensions, ";") {
+			name, _, _ := strings.Cut(extension, "=")
+			if strings.TrimSpace(name) == "" {
+				return 0, fmt.Errorf("%w: invalid extension: %q", ErrMalformedChunk, line)
+			}
+		}
+	}
+
+	return int(size), nil
+}
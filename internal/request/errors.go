@@ -0,0 +1,17 @@
+package request
+
+import "httpfromtcp/internal/headers"
+
+var (
+	ErrMalformedRequestLine = &headers.ParseError{Status: 400, Message: "error: malformed request line"}
+	ErrInvalidMethod        = &headers.ParseError{Status: 400, Message: "error: invalid method"}
+	ErrInvalidTarget        = &headers.ParseError{Status: 400, Message: "error: invalid request target"}
+	ErrUnsupportedVersion   = &headers.ParseError{Status: 505, Message: "error: unsupported http version"}
+	ErrIncompleteRequest    = &headers.ParseError{Status: 400, Message: "error: incomplete request"}
+	ErrMalformedChunk       = &headers.ParseError{Status: 400, Message: "error: malformed chunk"}
+	ErrBadFraming           = &headers.ParseError{Status: 400, Message: "error: invalid message framing"}
+	ErrUnsupportedCoding    = &headers.ParseError{Status: 501, Message: "error: unsupported transfer coding"}
+	ErrRequestLineTooLong   = &headers.ParseError{Status: 414, Message: "error: request line exceeds limit"}
+	ErrBodyTooLarge         = &headers.ParseError{Status: 413, Message: "error: request body exceeds limit"}
+	ErrExpectationFailed    = &headers.ParseError{Status: 417, Message: "error: unsupported expectation"}
+)
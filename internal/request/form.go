@@ -0,0 +1,279 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"io"
+	"maps"
+	"math"
+	"mime"
+	"mime/multipart"
+	"os"
+	"slices"
+)
+
+// FormLimits bounds how much of a form body is accepted and kept in memory.
+// As with Limits, a zero field means that dimension is unlimited; a zero
+// MaxMemory keeps every file part in memory.
+type FormLimits struct {
+	// MaxParts bounds the number of multipart parts or urlencoded pairs.
+	MaxParts int
+	// MaxPartSize bounds the size of a single multipart part.
+	MaxPartSize int64
+	// MaxValueBytes bounds the total size of the non-file values, and so
+	// the size of an urlencoded body.
+	MaxValueBytes int64
+	// MaxMemory is the size above which a file part is written to a
+	// temporary file instead of being held in memory.
+	MaxMemory int64
+}
+
+var DefaultFormLimits = FormLimits{
+	MaxParts:      1000,
+	MaxPartSize:   32 << 20,
+	MaxValueBytes: 10 << 20,
+	MaxMemory:     1 << 20,
+}
+
+// noLimit stands in for a zero limit. It leaves room for the +1 used to
+// detect a body that goes past its limit.
+const noLimit = math.MaxInt64 - 1
+
+// orUnlimited returns the limits with each zero field replaced by noLimit.
+func (l FormLimits) orUnlimited() FormLimits {
+	if l.MaxParts <= 0 {
+		l.MaxParts = math.MaxInt
+	}
+	if l.MaxPartSize <= 0 {
+		l.MaxPartSize = noLimit
+	}
+	if l.MaxValueBytes <= 0 {
+		l.MaxValueBytes = noLimit
+	}
+	if l.MaxMemory <= 0 {
+		l.MaxMemory = noLimit
+	}
+	return l
+}
+
+var (
+	ErrUnsupportedMediaType = &headers.ParseError{Status: 415, Message: "error: unsupported form media type"}
+	ErrMalformedForm        = &headers.ParseError{Status: 400, Message: "error: malformed form body"}
+	ErrTooManyParts         = &headers.ParseError{Status: 413, Message: "error: too many form parts"}
+	ErrPartTooLarge         = &headers.ParseError{Status: 413, Message: "error: form part exceeds limit"}
+)
+
+// Form holds a parsed multipart/form-data body. Call RemoveAll once done
+// with it to delete any temporary files.
+type Form struct {
+	Values map[string][]string
+	Files  map[string][]*FileHeader
+}
+
+// FileHeader describes a file part. Its content is in memory or, above
+// FormLimits.MaxMemory, in a temporary file.
+type FileHeader struct {
+	Filename string
+	Headers  *headers.Headers
+	Size     int64
+
+	content []byte
+	tmpFile string
+}
+
+func (f *FileHeader) Open() (io.ReadCloser, error) {
+	if f.tmpFile != "" {
+		return os.Open(f.tmpFile)
+	}
+	return io.NopCloser(bytes.NewReader(f.content)), nil
+}
+
+// RemoveAll deletes the temporary files backing the form's file parts.
+func (f *Form) RemoveAll() error {
+	var errs []error
+	for _, files := range f.Files {
+		for _, file := range files {
+			if file.tmpFile == "" {
+				continue
+			}
+			err := os.Remove(file.tmpFile)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseForm reads an application/x-www-form-urlencoded body into a map of
+// values.
+func (r *Request) ParseForm(limits FormLimits) (map[string][]string, error) {
+	mediaType, _, err := r.contentType()
+	if err != nil {
+		return nil, err
+	}
+	if mediaType != "application/x-www-form-urlencoded" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+	}
+	limits = limits.orUnlimited()
+
+	body, err := io.ReadAll(io.LimitReader(r.BodyReader, limits.MaxValueBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limits.MaxValueBytes {
+		return nil, fmt.Errorf("%w: body exceeds %d bytes", ErrPartTooLarge, limits.MaxValueBytes)
+	}
+	if bytes.Count(body, []byte("&")) >= limits.MaxParts {
+		return nil, fmt.Errorf("%w: more than %d pairs", ErrTooManyParts, limits.MaxParts)
+	}
+
+	values, err := ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedForm, err)
+	}
+	return values, nil
+}
+
+// ParseMultipartForm reads a multipart/form-data body part by part. Parts
+// with a filename become Files, the rest become Values.
+func (r *Request) ParseMultipartForm(limits FormLimits) (*Form, error) {
+	mediaType, params, err := r.contentType()
+	if err != nil {
+		return nil, err
+	}
+	if mediaType != "multipart/form-data" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+	}
+	limits = limits.orUnlimited()
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, fmt.Errorf("%w: missing boundary", ErrMalformedForm)
+	}
+
+	form := &Form{
+		Values: map[string][]string{},
+		Files:  map[string][]*FileHeader{},
+	}
+	err = form.readParts(multipart.NewReader(r.BodyReader, boundary), limits)
+	if err != nil {
+		form.RemoveAll()
+		return nil, err
+	}
+	return form, nil
+}
+
+func (f *Form) readParts(reader *multipart.Reader, limits FormLimits) error {
+	valueBytes := int64(0)
+	for numParts := 0; ; numParts++ {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return formError(err)
+		}
+		if numParts >= limits.MaxParts {
+			return fmt.Errorf("%w: more than %d parts", ErrTooManyParts, limits.MaxParts)
+		}
+
+		name := part.FormName()
+		if part.FileName() == "" {
+			value, err := readPart(part, min(limits.MaxPartSize, limits.MaxValueBytes-valueBytes))
+			if err != nil {
+				return err
+			}
+			valueBytes += int64(len(value))
+			f.Values[name] = append(f.Values[name], string(value))
+			continue
+		}
+
+		file, err := readFilePart(part, limits)
+		if err != nil {
+			return err
+		}
+		f.Files[name] = append(f.Files[name], file)
+	}
+}
+
+// readFilePart keeps a file part in memory up to MaxMemory and moves it to a
+// temporary file once it grows beyond that.
+func readFilePart(part *multipart.Part, limits FormLimits) (*FileHeader, error) {
+	// part.Header is a map, so its keys are sorted to keep the field order
+	// the same from one parse to the next.
+	h := headers.NewHeaders()
+	for _, key := range slices.Sorted(maps.Keys(part.Header)) {
+		for _, value := range part.Header[key] {
+			h.Add(key, value)
+		}
+	}
+	file := &FileHeader{
+		Filename: part.FileName(),
+		Headers:  h,
+	}
+
+	content, err := readPart(part, min(limits.MaxMemory, limits.MaxPartSize))
+	if err == nil {
+		file.content = content
+		file.Size = int64(len(content))
+		return file, nil
+	}
+	if !errors.Is(err, ErrPartTooLarge) || limits.MaxMemory >= limits.MaxPartSize {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "multipart-")
+	if err != nil {
+		return nil, err
+	}
+	defer tmp.Close()
+	file.tmpFile = tmp.Name()
+
+	size, err := io.Copy(tmp, io.MultiReader(bytes.NewReader(content), io.LimitReader(part, limits.MaxPartSize-int64(len(content))+1)))
+	if err == nil && size > limits.MaxPartSize {
+		err = fmt.Errorf("%w: part exceeds %d bytes", ErrPartTooLarge, limits.MaxPartSize)
+	}
+	if err != nil {
+		os.Remove(file.tmpFile)
+		return nil, err
+	}
+	file.Size = size
+	return file, nil
+}
+
+// readPart reads a whole part, returning ErrPartTooLarge along with the
+// bytes read so far if it is longer than limit.
+func readPart(part *multipart.Part, limit int64) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(part, limit+1))
+	if err != nil {
+		return nil, formError(err)
+	}
+	if int64(len(content)) > limit {
+		return content, fmt.Errorf("%w: part exceeds %d bytes", ErrPartTooLarge, limit)
+	}
+	return content, nil
+}
+
+// formError reports a failure reading the body as a malformed form, unless
+// the body reader already gave it a status, such as ErrBodyTooLarge.
+func formError(err error) error {
+	var parseErr *headers.ParseError
+	if errors.As(err, &parseErr) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrMalformedForm, err)
+}
+
+func (r *Request) contentType() (string, map[string]string, error) {
+	value, ok := r.Headers.Get("Content-Type")
+	if !ok {
+		return "", nil, fmt.Errorf("%w: missing content-type", ErrUnsupportedMediaType)
+	}
+	mediaType, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %w", ErrMalformedForm, err)
+	}
+	return mediaType, params, nil
+}
@@ -0,0 +1,105 @@
+package request
+
+import (
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"strconv"
+	"strings"
+)
+
+// bodyFraming applies the message body length rules of RFC 9112 section
+// 6.3. It reports whether the body is chunked, and otherwise its length,
+// which is 0 when the request has no body. Headers that do not determine the
+// length unambiguously could be read differently by another hop, so they
+// are rejected with ErrBadFraming instead of guessed at.
+func bodyFraming(h *headers.Headers) (bool, int, error) {
+	transferEncodings := h.Values("Transfer-Encoding")
+	contentLengths := h.Values("Content-Length")
+
+	if len(transferEncodings) > 0 {
+		if len(contentLengths) > 0 {
+			return false, 0, fmt.Errorf("%w: both transfer-encoding and content-length present", ErrBadFraming)
+		}
+		err := checkTransferCodings(transferEncodings)
+		if err != nil {
+			return false, 0, err
+		}
+		return true, 0, nil
+	}
+
+	if len(contentLengths) == 0 {
+		return false, 0, nil
+	}
+	contentLength, err := parseContentLength(contentLengths)
+	if err != nil {
+		return false, 0, err
+	}
+	return false, contentLength, nil
+}
+
+// checkTransferCodings requires chunked to be applied exactly once and last,
+// otherwise the end of the body cannot be found. Any other coding would
+// reach the handler still encoded, so it is refused with
+// ErrUnsupportedCoding, which is answered with 501.
+func checkTransferCodings(fieldValues []string) error {
+	codings := []string{}
+	for _, value := range fieldValues {
+		for _, coding := range strings.Split(value, ",") {
+			coding = strings.TrimSpace(coding)
+			if coding != "" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+
+	for i, coding := range codings {
+		isChunked := strings.EqualFold(coding, "chunked")
+		if isChunked && i != len(codings)-1 {
+			return fmt.Errorf("%w: chunked is not the final transfer coding", ErrBadFraming)
+		}
+		if !isChunked && i == len(codings)-1 {
+			return fmt.Errorf("%w: final transfer coding is not chunked: %s", ErrBadFraming, coding)
+		}
+	}
+	if len(codings) > 1 {
+		return fmt.Errorf("%w: %s", ErrUnsupportedCoding, codings[0])
+	}
+	return nil
+}
+
+// parseContentLength accepts repeated Content-Length values, whether in
+// separate fields or a comma-separated list, only if they are all the same
+// non-negative decimal number.
+func parseContentLength(fieldValues []string) (int, error) {
+	contentLength := -1
+	for _, value := range fieldValues {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if !isDigits(part) {
+				return 0, fmt.Errorf("%w: invalid content-length: %q", ErrBadFraming, part)
+			}
+
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("%w: invalid content-length: %q", ErrBadFraming, part)
+			}
+			if contentLength != -1 && n != contentLength {
+				return 0, fmt.Errorf("%w: conflicting content-length values: %d and %d", ErrBadFraming, contentLength, n)
+			}
+			contentLength = n
+		}
+	}
+	return contentLength, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
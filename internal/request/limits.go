@@ -0,0 +1,49 @@
+package request
+
+import (
+	"fmt"
+	"httpfromtcp/internal/headers"
+)
+
+// Limits bounds how much of a request the parser will accept. A zero field
+// means that dimension is unlimited.
+type Limits struct {
+	MaxRequestLineLength int
+	MaxHeaderBytes       int
+	MaxHeaderCount       int
+	MaxBodySize          int
+}
+
+var DefaultLimits = Limits{
+	MaxRequestLineLength: 8 << 10,
+	MaxHeaderBytes:       1 << 20,
+	MaxHeaderCount:       100,
+	MaxBodySize:          10 << 20,
+}
+
+// maxChunkLineLength bounds a chunk-size line including its extensions.
+const maxChunkLineLength = 4 << 10
+
+func (l Limits) checkRequestLine(length int) error {
+	if l.MaxRequestLineLength > 0 && length > l.MaxRequestLineLength {
+		return fmt.Errorf("%w: %d bytes", ErrRequestLineTooLong, length)
+	}
+	return nil
+}
+
+func (l Limits) checkHeaders(numBytes, count int) error {
+	if l.MaxHeaderBytes > 0 && numBytes > l.MaxHeaderBytes {
+		return fmt.Errorf("%w: %d bytes", headers.ErrFieldsTooLarge, numBytes)
+	}
+	if l.MaxHeaderCount > 0 && count > l.MaxHeaderCount {
+		return fmt.Errorf("%w: %d fields", headers.ErrTooManyFields, count)
+	}
+	return nil
+}
+
+func (l Limits) checkBody(size int) error {
+	if l.MaxBodySize > 0 && size > l.MaxBodySize {
+		return fmt.Errorf("%w: %d bytes", ErrBodyTooLarge, size)
+	}
+	return nil
+}
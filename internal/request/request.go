@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"httpfromtcp/internal/headers"
 	"io"
-	"strconv"
 	"strings"
 )
 
@@ -16,14 +15,37 @@ const (
 	initialised RequestParseState = iota
 	parsingHeaders
 	parsingBody
+	parsingFixedBody
+	parsingChunkSize
+	parsingChunkData
+	parsingChunkDataEnd
+	parsingTrailers
 	done
 )
 
 type Request struct {
 	RequestLine       RequestLine
-	Headers           headers.Headers
+	Target            Target
+	Headers           *headers.Headers
 	Body              []byte
+	Trailers          *headers.Headers
 	RequestParseState RequestParseState
+
+	// BodyReader reads the request body. When the Reader streams bodies it
+	// pulls from the connection lazily and Body is left empty; otherwise it
+	// reads from Body. The server closes it once the handler returns.
+	BodyReader io.ReadCloser
+
+	// Params holds the path parameters captured by the router.
+	Params map[string]string
+
+	limits        Limits
+	streamBody    bool
+	pending       []byte
+	headerBytes   int
+	headerCount   int
+	bodyRead      int
+	bodyRemaining int
 }
 
 type RequestLine struct {
@@ -35,47 +57,192 @@ type RequestLine struct {
 const crlf = "\r\n"
 const bufferSize = 8
 
+// Reader parses successive requests from a single connection. Bytes read
+// past the end of one request are kept and used for the next, so pipelined
+// requests are not lost.
+type Reader struct {
+	// StreamBody makes ReadRequest return as soon as the headers are parsed,
+	// leaving the body to be read through Request.BodyReader.
+	StreamBody bool
+	Limits     Limits
+
+	reader      io.Reader
+	buf         []byte
+	readToIndex int
+	eof         bool
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		Limits: DefaultLimits,
+		reader: reader,
+		buf:    make([]byte, bufferSize),
+	}
+}
+
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, bufferSize)
-	readToIndex := 0
+	return NewReader(reader).ReadRequest()
+}
+
+// ReadRequest parses the next request. It returns io.EOF if the connection
+// was closed cleanly before any byte of a new request arrived.
+func (r *Reader) ReadRequest() (*Request, error) {
 	req := &Request{
 		RequestParseState: initialised,
 		Headers:           headers.NewHeaders(),
 		Body:              []byte{},
+		Trailers:          headers.NewHeaders(),
+		limits:            r.Limits,
+		streamBody:        r.StreamBody,
 	}
 
-	for req.RequestParseState != done {
-		if readToIndex >= bufferSize {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf)
-			buf = newBuf
+	for {
+		err := r.parseBuffered(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if req.RequestParseState == done || (r.StreamBody && req.headersDone()) {
+			break
 		}
 
-		numBytesRead, err := reader.Read(buf[readToIndex:])
+		err = r.readMore(req)
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				if req.RequestParseState != parsingHeaders && req.RequestParseState != parsingBody {
-					return nil, fmt.Errorf("incomplete request, in state: %d, read n bytes on EOF: %d", req.RequestParseState, numBytesRead)
-				} else if numBytesRead == 0 {
-					return nil, fmt.Errorf("incomplete request")
-				}
-				break
-			}
-
 			return nil, err
 		}
-		readToIndex += numBytesRead
+	}
+
+	if r.StreamBody {
+		req.BodyReader = &body{reader: r, req: req}
+	} else {
+		req.BodyReader = io.NopCloser(bytes.NewReader(req.Body))
+	}
+	return req, nil
+}
 
-		numBytesParsed, err := req.parse(buf[:readToIndex])
+// WaitForRequest blocks until the first bytes of the next request have
+// arrived. It returns io.EOF if the connection is closed first.
+func (r *Reader) WaitForRequest() error {
+	for r.readToIndex == 0 {
+		if r.eof {
+			return io.EOF
+		}
+
+		numBytesRead, err := r.reader.Read(r.buf)
+		r.readToIndex += numBytesRead
 		if err != nil {
-			return nil, err
+			if !errors.Is(err, io.EOF) {
+				return err
+			}
+			r.eof = true
 		}
+	}
+	return nil
+}
+
+func (r *Reader) parseBuffered(req *Request) error {
+	numBytesParsed, err := req.parse(r.buf[:r.readToIndex])
+	if err != nil {
+		return err
+	}
+	copy(r.buf, r.buf[numBytesParsed:r.readToIndex])
+	r.readToIndex -= numBytesParsed
+	return nil
+}
 
-		copy(buf, buf[numBytesParsed:])
-		readToIndex -= numBytesParsed
+func (r *Reader) readMore(req *Request) error {
+	if r.eof {
+		if req.RequestParseState == initialised && r.readToIndex == 0 {
+			return io.EOF
+		}
+		return fmt.Errorf("%w: in state: %d, unparsed bytes on EOF: %d", ErrIncompleteRequest, req.RequestParseState, r.readToIndex)
 	}
 
-	return req, nil
+	if r.readToIndex >= len(r.buf) {
+		newBuf := make([]byte, len(r.buf)*2)
+		copy(newBuf, r.buf)
+		r.buf = newBuf
+	}
+
+	numBytesRead, err := r.reader.Read(r.buf[r.readToIndex:])
+	r.readToIndex += numBytesRead
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+		r.eof = true
+	}
+	return nil
+}
+
+// countHeaderBytes applies the header limits to the header and trailer
+// sections. While a field line is incomplete the unparsed bytes are counted
+// too, so an endless line cannot grow the buffer past the limit.
+func (r *Request) countHeaderBytes(data []byte, numBytes int, isDone bool) error {
+	if numBytes == 0 {
+		return r.limits.checkHeaders(r.headerBytes+len(data), r.headerCount)
+	}
+
+	r.headerBytes += numBytes
+	if !isDone {
+		r.headerCount++
+	}
+	return r.limits.checkHeaders(r.headerBytes, r.headerCount)
+}
+
+func (r *Request) headersDone() bool {
+	return r.RequestParseState != initialised && r.RequestParseState != parsingHeaders
+}
+
+// appendBody stores parsed body bytes, either in Body or, when the body is
+// streamed, until they are handed out by BodyReader.
+func (r *Request) appendBody(p []byte) error {
+	r.bodyRead += len(p)
+	err := r.limits.checkBody(r.bodyRead)
+	if err != nil {
+		return err
+	}
+
+	if r.streamBody {
+		r.pending = append(r.pending, p...)
+	} else {
+		r.Body = append(r.Body, p...)
+	}
+	return nil
+}
+
+// Param returns the named path parameter, or "" if it was not captured.
+func (r *Request) Param(name string) string {
+	return r.Params[name]
+}
+
+// KeepAlive reports whether the client allows the connection to be reused
+// after this request. HTTP/1.1 connections persist unless the client sends
+// "Connection: close"; HTTP/1.0 ones only if it sends "Connection:
+// keep-alive".
+func (r *Request) KeepAlive() bool {
+	value, _ := r.Headers.Get("Connection")
+	if headers.HasToken(value, "close") {
+		return false
+	}
+	if r.RequestLine.HttpVersion == "1.0" {
+		return headers.HasToken(value, "keep-alive")
+	}
+	return true
+}
+
+// ExpectsContinue reports whether the client is waiting for a 100 Continue
+// before sending the body. Expect is ignored in HTTP/1.0 requests, and any
+// expectation other than 100-continue fails with ErrExpectationFailed.
+func (r *Request) ExpectsContinue() (bool, error) {
+	value, ok := r.Headers.Get("Expect")
+	if !ok || r.RequestLine.HttpVersion == "1.0" {
+		return false, nil
+	}
+	if !strings.EqualFold(strings.TrimSpace(value), "100-continue") {
+		return false, fmt.Errorf("%w: %s", ErrExpectationFailed, value)
+	}
+	return r.RequestParseState != done, nil
 }
 
 func parseRequestLine(req []byte) (*RequestLine, int, error) {
@@ -96,10 +263,13 @@ func parseRequestLine(req []byte) (*RequestLine, int, error) {
 func requestLineFromString(req string) (*RequestLine, error) {
 	parts := strings.Split(req, " ")
 	if len(parts) != 3 {
-		return nil, fmt.Errorf("error: http version, request target, and method are not seperate: %s", req)
+		return nil, fmt.Errorf("%w: http version, request target, and method are not seperate: %q", ErrMalformedRequestLine, req)
 	}
 
 	method := parts[0]
+	if method == "" {
+		return nil, fmt.Errorf("%w: empty method", ErrInvalidMethod)
+	}
 	allowedLetters := map[string]bool{
 		"A": true,
 		"B": true,
@@ -130,35 +300,52 @@ func requestLineFromString(req string) (*RequestLine, error) {
 	}
 	for _, letter := range method {
 		if _, ok := allowedLetters[string(letter)]; !ok {
-			return nil, fmt.Errorf("error: invalid method: %s", method)
+			return nil, fmt.Errorf("%w: %q", ErrInvalidMethod, method)
 		}
 	}
 
 	requestTarget := parts[1]
+	if requestTarget == "" {
+		return nil, fmt.Errorf("%w: empty request target", ErrMalformedRequestLine)
+	}
 
 	version := parts[2]
-	versionParts := strings.Split(version, "/")
-	if versionParts[0] != "HTTP" || versionParts[1] != "1.1" {
-		return nil, fmt.Errorf("error: invalid http version: %s", version)
+	protocol, versionNumber, ok := strings.Cut(version, "/")
+	if !ok || protocol != "HTTP" || !isVersionNumber(versionNumber) {
+		return nil, fmt.Errorf("%w: invalid http version: %q", ErrMalformedRequestLine, version)
+	}
+	if versionNumber[0] != '1' {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedVersion, version)
+	}
+	if versionNumber != "1.0" {
+		// A later 1.x minor version is handled as the highest one we know.
+		versionNumber = "1.1"
 	}
 
 	return &RequestLine{
-		HttpVersion:   versionParts[1],
+		HttpVersion:   versionNumber,
 		RequestTarget: requestTarget,
 		Method:        method,
 	}, nil
 }
 
+// isVersionNumber reports whether s has the DIGIT "." DIGIT form of an
+// HTTP/1.x version.
+func isVersionNumber(s string) bool {
+	return len(s) == 3 && isDigits(s[:1]) && s[1] == '.' && isDigits(s[2:])
+}
+
 func (r *Request) parse(data []byte) (int, error) {
 	totalBytesParsed := 0
 	for r.RequestParseState != done {
+		state := r.RequestParseState
 		n, err := r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
 			return 0, err
 		}
 		totalBytesParsed += n
 
-		if n == 0 {
+		if n == 0 && r.RequestParseState == state {
 			break
 		}
 	}
@@ -174,10 +361,20 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 			return 0, err
 		}
 		if numBytes == 0 {
-			return 0, nil
+			return 0, r.limits.checkRequestLine(len(data))
+		}
+		err = r.limits.checkRequestLine(numBytes - len(crlf))
+		if err != nil {
+			return 0, err
+		}
+
+		target, err := parseTarget(requestLine.Method, requestLine.RequestTarget)
+		if err != nil {
+			return 0, err
 		}
 
 		r.RequestLine = *requestLine
+		r.Target = target
 		r.RequestParseState = parsingHeaders
 		return numBytes, nil
 	case parsingHeaders:
@@ -185,6 +382,10 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		if err != nil {
 			return 0, err
 		}
+		err = r.countHeaderBytes(data, numBytes, isDone)
+		if err != nil {
+			return 0, err
+		}
 
 		if isDone {
 			r.RequestParseState = parsingBody
@@ -192,24 +393,45 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 
 		return numBytes, nil
 	case parsingBody:
-		contentLengthStr, ok := r.Headers.Get("Content-Length")
-		if !ok {
-			r.RequestParseState = done
-			return len(data), nil
+		chunked, contentLength, err := bodyFraming(r.Headers)
+		if err != nil {
+			return 0, err
 		}
-		contentLength, err := strconv.Atoi(contentLengthStr)
+		if chunked {
+			r.RequestParseState = parsingChunkSize
+			return 0, nil
+		}
+
+		err = r.limits.checkBody(contentLength)
 		if err != nil {
 			return 0, err
 		}
 
-		r.Body = append(r.Body, data...)
+		if contentLength == 0 {
+			r.RequestParseState = done
+			return 0, nil
+		}
+
+		r.bodyRemaining = contentLength
+		r.RequestParseState = parsingFixedBody
+		return 0, nil
+	case parsingFixedBody:
+		n := r.bodyRemaining
+		if n > len(data) {
+			n = len(data)
+		}
+		err := r.appendBody(data[:n])
+		if err != nil {
+			return 0, err
+		}
+		r.bodyRemaining -= n
 
-		if len(r.Body) > contentLength {
-			return 0, fmt.Errorf("error: body is larger than content-length: body: %d, content-length: %d", len(r.Body), contentLength)
-		} else if len(r.Body) == contentLength {
+		if r.bodyRemaining == 0 {
 			r.RequestParseState = done
 		}
-		return len(data), nil
+		return n, nil
+	case parsingChunkSize, parsingChunkData, parsingChunkDataEnd, parsingTrailers:
+		return r.parseChunked(data)
 	case done:
 		return 0, fmt.Errorf("error: trying to read data in a done state")
 	default:
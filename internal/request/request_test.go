@@ -1,7 +1,13 @@
 package request
 
 import (
+	"bytes"
+	"httpfromtcp/internal/headers"
 	"io"
+	"mime/multipart"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -68,6 +74,37 @@ func TestRequestLineParse(t *testing.T) {
 	}
 	r, err = RequestFromReader(reader)
 	require.Error(t, err)
+
+	// Test: HTTP/1.0 Request line
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.0\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.False(t, r.KeepAlive())
+
+	// Test: HTTP/1.0 Request with keep-alive
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.True(t, r.KeepAlive())
+
+	// Test: Later HTTP/1.x minor version
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.2\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
 }
 
 type chunkReader struct {
@@ -99,9 +136,9 @@ func TestHeaders(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, []string{"localhost:42069"}, r.Headers.Values("host"))
+	assert.Equal(t, []string{"curl/7.81.0"}, r.Headers.Values("user-agent"))
+	assert.Equal(t, []string{"*/*"}, r.Headers.Values("accept"))
 
 	// Test: Empty Headers
 	reader = &chunkReader{
@@ -111,7 +148,7 @@ func TestHeaders(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Empty(t, r.Headers)
+	assert.Equal(t, 0, r.Headers.Len())
 
 	// Test: Malformed Header
 	reader = &chunkReader{
@@ -123,14 +160,22 @@ func TestHeaders(t *testing.T) {
 
 	// Test: Duplicate Headers
 	reader = &chunkReader{
-		data:            "GET / HTTP/1.1\r\nHost: localhost:69420\r\n  Host: localhost:42069  \r\n Host: localhost:69420\r\n\r\n",
+		data:            "GET / HTTP/1.1\r\nHost: localhost:69420\r\nHost: localhost:42069  \r\nHost: localhost:69420\r\n\r\n",
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:69420, localhost:42069, localhost:69420", r.Headers["host"])
-	assert.Equal(t, 1, len(r.Headers))
+	assert.Equal(t, []string{"localhost:69420", "localhost:42069", "localhost:69420"}, r.Headers.Values("host"))
+	assert.Equal(t, 3, r.Headers.Len())
+
+	// Test: Folded line is not read as another field
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: a\r\n Host: b\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, headers.ErrMalformedFieldLine)
 
 	// Test: Case-Insensitive Headers
 	reader = &chunkReader{
@@ -140,8 +185,8 @@ func TestHeaders(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:69420", r.Headers["host"])
-	assert.Equal(t, 1, len(r.Headers))
+	assert.Equal(t, []string{"localhost:69420"}, r.Headers.Values("HOST"))
+	assert.Equal(t, 1, r.Headers.Len())
 
 	// Test: Missing End of Headers
 	reader = &chunkReader{
@@ -217,3 +262,584 @@ func TestBody(t *testing.T) {
 	require.NotNil(t, r)
 	assert.Equal(t, []byte{}, r.Body)
 }
+
+func TestPipelinedRequests(t *testing.T) {
+	// Test: Two requests in a single stream
+	reader := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /next HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Connection: close\r\n" +
+			"\r\n",
+		numBytesPerRead: 64,
+	})
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/submit", r.RequestLine.RequestTarget)
+	assert.Equal(t, "hello", string(r.Body))
+	assert.True(t, r.KeepAlive())
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+	assert.Equal(t, []byte{}, r.Body)
+	assert.False(t, r.KeepAlive())
+
+	// Test: Clean EOF between requests
+	r, err = reader.ReadRequest()
+	require.ErrorIs(t, err, io.EOF)
+	assert.Nil(t, r)
+}
+
+func TestChunkedBody(t *testing.T) {
+	// Test: Chunked body with extensions and trailers
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"7;name=value\r\n world!\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!", string(r.Body))
+	assert.Equal(t, []string{"abc"}, r.Trailers.Values("x-checksum"))
+
+	// Test: Empty chunked body
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, []byte{}, r.Body)
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Signed or prefixed chunk sizes are rejected
+	for _, size := range []string{"+5", "-0", "+0", "0x5"} {
+		reader = &chunkReader{
+			data: "POST /submit HTTP/1.1\r\n" +
+				"Host: localhost:42069\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				size + "\r\nhello\r\n0\r\n\r\n",
+			numBytesPerRead: 3,
+		}
+		_, err = RequestFromReader(reader)
+		require.ErrorIs(t, err, ErrMalformedChunk, size)
+	}
+
+	// Test: Chunk data longer than chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Missing terminating chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestStreamBody(t *testing.T) {
+	// Test: Body is read lazily after the headers
+	reader := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n",
+		numBytesPerRead: 3,
+	})
+	reader.StreamBody = true
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Empty(t, r.Body)
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
+
+	// Test: Unread chunked body is drained on Close
+	reader = NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n0\r\n\r\n" +
+			"GET /next HTTP/1.1\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	})
+	reader.StreamBody = true
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	require.NoError(t, r.BodyReader.Close())
+	_, err = r.BodyReader.Read(make([]byte, 1))
+	require.ErrorIs(t, err, ErrBodyClosed)
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+
+	// Test: Body shorter than reported content length
+	reader = NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 20\r\n" +
+			"\r\n" +
+			"partial content",
+		numBytesPerRead: 3,
+	})
+	reader.StreamBody = true
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.BodyReader)
+	require.Error(t, err)
+
+	// Test: Only a body that fits the drain budget is drainable
+	for _, tc := range []struct {
+		framing   string
+		drainable bool
+	}{
+		{"Content-Length: 13\r\n", true},
+		{"Content-Length: 1048576\r\n", false},
+		{"Transfer-Encoding: chunked\r\n", false},
+	} {
+		reader = NewReader(strings.NewReader("POST /submit HTTP/1.1\r\n" + tc.framing + "\r\n"))
+		reader.StreamBody = true
+		r, err = reader.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, tc.drainable, r.BodyDrainable(), tc.framing)
+	}
+	reader = NewReader(strings.NewReader("POST /submit HTTP/1.1\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"5\r\nhello\r\n0\r\n\r\n"))
+	reader.StreamBody = true
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.True(t, r.BodyDrainable())
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineLength: 32,
+		MaxHeaderBytes:       64,
+		MaxHeaderCount:       2,
+		MaxBodySize:          8,
+	}
+
+	// Test: Request line too long
+	reader := NewReader(&chunkReader{
+		data:            "GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	reader.Limits = limits
+	_, err := reader.ReadRequest()
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Too many header fields
+	reader = NewReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	reader.Limits = limits
+	_, err = reader.ReadRequest()
+	require.ErrorIs(t, err, headers.ErrTooManyFields)
+
+	// Test: Header section too large
+	reader = NewReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\nA: " + strings.Repeat("a", 128) + "\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	reader.Limits = limits
+	_, err = reader.ReadRequest()
+	require.ErrorIs(t, err, headers.ErrFieldsTooLarge)
+
+	// Test: Content-Length above limit
+	reader = NewReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 13\r\n\r\nhello world!\n",
+		numBytesPerRead: 3,
+	})
+	reader.Limits = limits
+	_, err = reader.ReadRequest()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body above limit
+	reader = NewReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n5\r\nworld\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	reader.Limits = limits
+	_, err = reader.ReadRequest()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestReadBody(t *testing.T) {
+	// Test: Streamed body is buffered into Body
+	reader := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	reader.StreamBody = true
+	require.NoError(t, reader.WaitForRequest())
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	require.NoError(t, r.ReadBody())
+	assert.Equal(t, "hello", string(r.Body))
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: Waiting on a closed connection
+	require.ErrorIs(t, reader.WaitForRequest(), io.EOF)
+}
+
+func TestFraming(t *testing.T) {
+	// Test: Identical duplicate Content-Length values
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"Content-Length: 5, 5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Conflicting Content-Length values
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"Content-Length: 6\r\n" +
+			"\r\n" +
+			"hello!",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrBadFraming)
+
+	// Test: Signed Content-Length
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: +5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrBadFraming)
+
+	// Test: Content-Length together with Transfer-Encoding
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrBadFraming)
+
+	// Test: Chunked is not the final coding
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked, gzip\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrBadFraming)
+
+	// Test: Codings other than chunked are not supported
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: gzip, chunked\r\n" +
+			"\r\n" +
+			"2\r\nhi\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrUnsupportedCoding)
+
+	// Test: Chunked applied twice
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrBadFraming)
+}
+
+func TestParseErrorStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		err        error
+		statusCode int
+	}{
+		{"malformed request line", "GET /\r\n\r\n", ErrMalformedRequestLine, 400},
+		{"version without slash", "GET / HTTP\r\n\r\n", ErrMalformedRequestLine, 400},
+		{"invalid method", "get / HTTP/1.1\r\n\r\n", ErrInvalidMethod, 400},
+		{"unsupported version", "GET / HTTP/2.0\r\n\r\n", ErrUnsupportedVersion, 505},
+		{"missing colon", "GET / HTTP/1.1\r\nHost\r\n\r\n", headers.ErrMalformedFieldLine, 400},
+		{"bad header name", "GET / HTTP/1.1\r\nH@st: x\r\n\r\n", headers.ErrInvalidFieldName, 400},
+		{"incomplete request", "GET / HTTP/1.1\r\nHost: x\r\n", ErrIncompleteRequest, 400},
+		{"malformed chunk", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nxyz\r\n", ErrMalformedChunk, 400},
+		{"unsupported coding", "POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\nTransfer-Encoding: chunked\r\n\r\n", ErrUnsupportedCoding, 501},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RequestFromReader(&chunkReader{data: tt.data, numBytesPerRead: 3})
+			require.ErrorIs(t, err, tt.err)
+			var parseErr *headers.ParseError
+			require.ErrorAs(t, err, &parseErr)
+			assert.Equal(t, tt.statusCode, parseErr.StatusCode())
+		})
+	}
+}
+
+func TestRequestTarget(t *testing.T) {
+	// Test: Origin-form with query
+	r, err := RequestFromReader(strings.NewReader("GET /search/caf%C3%A9?q=a+b&q=c%26d&empty HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, OriginForm, r.Target.Form)
+	assert.Equal(t, "/search/café", r.Target.Path)
+	assert.Equal(t, "/search/caf%C3%A9", r.Target.RawPath)
+	assert.Equal(t, "q=a+b&q=c%26d&empty", r.Target.RawQuery)
+	assert.Equal(t, []string{"a b", "c&d"}, r.Target.Query["q"])
+	assert.Equal(t, []string{""}, r.Target.Query["empty"])
+	assert.Equal(t, "a b", r.QueryParam("q"))
+
+	// Test: Absolute-form
+	r, err = RequestFromReader(strings.NewReader("GET http://example.com:8080/a/b?x=1 HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, AbsoluteForm, r.Target.Form)
+	assert.Equal(t, "http", r.Target.Scheme)
+	assert.Equal(t, "example.com:8080", r.Target.Authority)
+	assert.Equal(t, "/a/b", r.Target.Path)
+	assert.Equal(t, "1", r.QueryParam("x"))
+
+	// Test: Authority-form
+	r, err = RequestFromReader(strings.NewReader("CONNECT example.com:443 HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, AuthorityForm, r.Target.Form)
+	assert.Equal(t, "example.com:443", r.Target.Authority)
+
+	// Test: Asterisk-form
+	r, err = RequestFromReader(strings.NewReader("OPTIONS * HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, AsteriskForm, r.Target.Form)
+
+	// Test: Invalid targets
+	for _, line := range []string{
+		"GET /bad%2 HTTP/1.1",
+		"GET /bad%zz HTTP/1.1",
+		"GET /?q=%G1 HTTP/1.1",
+		"GET * HTTP/1.1",
+		"GET example.com HTTP/1.1",
+		"CONNECT /path HTTP/1.1",
+		"GET /a#frag HTTP/1.1",
+	} {
+		_, err = RequestFromReader(strings.NewReader(line + "\r\n\r\n"))
+		require.ErrorIs(t, err, ErrInvalidTarget, line)
+	}
+}
+
+func TestParseForm(t *testing.T) {
+	// Test: Urlencoded body
+	r, err := RequestFromReader(strings.NewReader("POST /form HTTP/1.1\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\n" +
+		"Content-Length: 23\r\n" +
+		"\r\n" +
+		"name=Jane+Doe&tag=a&tag"))
+	require.NoError(t, err)
+	values, err := r.ParseForm(DefaultFormLimits)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Jane Doe"}, values["name"])
+	assert.Equal(t, []string{"a", ""}, values["tag"])
+
+	// Test: Wrong media type
+	r, err = RequestFromReader(strings.NewReader("POST /form HTTP/1.1\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n"))
+	require.NoError(t, err)
+	_, err = r.ParseForm(DefaultFormLimits)
+	require.ErrorIs(t, err, ErrUnsupportedMediaType)
+
+	// Test: Too many pairs
+	r, err = RequestFromReader(strings.NewReader("POST /form HTTP/1.1\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\n" +
+		"Content-Length: 11\r\n" +
+		"\r\n" +
+		"a=1&b=2&c=3"))
+	require.NoError(t, err)
+	_, err = r.ParseForm(FormLimits{MaxParts: 2, MaxValueBytes: 1024})
+	require.ErrorIs(t, err, ErrTooManyParts)
+
+	// Test: Zero limits are unlimited
+	r, err = RequestFromReader(strings.NewReader("POST /form HTTP/1.1\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\n" +
+		"Content-Length: 11\r\n" +
+		"\r\n" +
+		"a=1&b=2&c=3"))
+	require.NoError(t, err)
+	values, err = r.ParseForm(FormLimits{})
+	require.NoError(t, err)
+	assert.Len(t, values, 3)
+}
+
+func TestParseMultipartForm(t *testing.T) {
+	newRequest := func(t *testing.T, fileContent string) *Request {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		require.NoError(t, mw.WriteField("title", "holiday"))
+		fw, err := mw.CreateFormFile("photo", "beach.jpg")
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(fileContent))
+		require.NoError(t, err)
+		require.NoError(t, mw.Close())
+
+		r, err := RequestFromReader(strings.NewReader("POST /upload HTTP/1.1\r\n" +
+			"Content-Type: " + mw.FormDataContentType() + "\r\n" +
+			"Content-Length: " + strconv.Itoa(body.Len()) + "\r\n" +
+			"\r\n" +
+			body.String()))
+		require.NoError(t, err)
+		return r
+	}
+	limits := FormLimits{MaxParts: 10, MaxPartSize: 64, MaxValueBytes: 64, MaxMemory: 16}
+
+	// Test: Small file is kept in memory
+	form, err := newRequest(t, "tiny").ParseMultipartForm(limits)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"holiday"}, form.Values["title"])
+	require.Len(t, form.Files["photo"], 1)
+	file := form.Files["photo"][0]
+	assert.Equal(t, "beach.jpg", file.Filename)
+	assert.Equal(t, int64(4), file.Size)
+	assert.Empty(t, file.tmpFile)
+
+	// Test: Part headers are in a stable order
+	fields := file.Headers.Fields()
+	require.Len(t, fields, 2)
+	assert.Equal(t, "Content-Disposition", fields[0].Name)
+	assert.Equal(t, "Content-Type", fields[1].Name)
+
+	// Test: Zero limits are unlimited and keep files in memory
+	form, err = newRequest(t, strings.Repeat("x", 100)).ParseMultipartForm(FormLimits{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), form.Files["photo"][0].Size)
+	assert.Empty(t, form.Files["photo"][0].tmpFile)
+
+	// Test: Large file is written to disk
+	content := strings.Repeat("x", 40)
+	form, err = newRequest(t, content).ParseMultipartForm(limits)
+	require.NoError(t, err)
+	file = form.Files["photo"][0]
+	require.NotEmpty(t, file.tmpFile)
+	f, err := file.Open()
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, content, string(data))
+	require.NoError(t, form.RemoveAll())
+	_, err = os.Stat(file.tmpFile)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Test: File above the part limit
+	_, err = newRequest(t, strings.Repeat("x", 100)).ParseMultipartForm(limits)
+	require.ErrorIs(t, err, ErrPartTooLarge)
+
+	// Test: Too many parts
+	limits.MaxParts = 1
+	_, err = newRequest(t, "tiny").ParseMultipartForm(limits)
+	require.ErrorIs(t, err, ErrTooManyParts)
+}
+
+func TestExpectsContinue(t *testing.T) {
+	// Test: Client waits for 100 Continue before sending the body
+	reader := NewReader(strings.NewReader("POST /upload HTTP/1.1\r\nHost: localhost:42069\r\nExpect: 100-Continue\r\nContent-Length: 5\r\n\r\n"))
+	reader.StreamBody = true
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	expect, err := r.ExpectsContinue()
+	require.NoError(t, err)
+	assert.True(t, expect)
+
+	// Test: No interim response is needed without a body
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\nExpect: 100-continue\r\n\r\n"))
+	require.NoError(t, err)
+	expect, err = r.ExpectsContinue()
+	require.NoError(t, err)
+	assert.False(t, expect)
+
+	// Test: Expect is ignored in HTTP/1.0 requests
+	reader = NewReader(strings.NewReader("POST / HTTP/1.0\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n"))
+	reader.StreamBody = true
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	expect, err = r.ExpectsContinue()
+	require.NoError(t, err)
+	assert.False(t, expect)
+
+	// Test: Unknown expectation fails with 417
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\nExpect: something-else\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = r.ExpectsContinue()
+	require.ErrorIs(t, err, ErrExpectationFailed)
+	assert.Equal(t, 417, ErrExpectationFailed.StatusCode())
+}
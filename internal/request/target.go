@@ -0,0 +1,210 @@
+package request
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TargetForm is one of the four request-target forms of RFC 9112 section
+// 3.2.
+type TargetForm int
+
+const (
+	// OriginForm is an absolute path with an optional query: "/where?q=now".
+	OriginForm TargetForm = iota
+	// AbsoluteForm is a full URI, as sent to proxies: "http://host/where".
+	AbsoluteForm
+	// AuthorityForm is the "host:port" target of a CONNECT request.
+	AuthorityForm
+	// AsteriskForm is the "*" target of a server-wide OPTIONS request.
+	AsteriskForm
+)
+
+// Target is the parsed request-target. Path is percent-decoded; RawPath and
+// RawQuery are as sent.
+type Target struct {
+	Form      TargetForm
+	Scheme    string
+	Authority string
+	Path      string
+	RawPath   string
+	RawQuery  string
+	Query     map[string][]string
+}
+
+// QueryParam returns the first value of the named query parameter, or "" if
+// it is absent.
+func (r *Request) QueryParam(name string) string {
+	values := r.Target.Query[name]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func parseTarget(method, requestTarget string) (Target, error) {
+	for i := 0; i < len(requestTarget); i++ {
+		c := requestTarget[i]
+		if c <= ' ' || c == 0x7f || c == '#' {
+			return Target{}, fmt.Errorf("%w: invalid character %q", ErrInvalidTarget, c)
+		}
+	}
+
+	switch {
+	case method == "CONNECT":
+		if !isAuthority(requestTarget) {
+			return Target{}, fmt.Errorf("%w: CONNECT requires host:port: %q", ErrInvalidTarget, requestTarget)
+		}
+		return Target{Form: AuthorityForm, Authority: requestTarget, Query: map[string][]string{}}, nil
+	case requestTarget == "*":
+		if method != "OPTIONS" {
+			return Target{}, fmt.Errorf("%w: * is only allowed for OPTIONS", ErrInvalidTarget)
+		}
+		return Target{Form: AsteriskForm, Path: "*", RawPath: "*", Query: map[string][]string{}}, nil
+	case strings.HasPrefix(requestTarget, "/"):
+		return parseOriginForm(requestTarget)
+	}
+
+	scheme, rest, ok := strings.Cut(requestTarget, "://")
+	if !ok || !isScheme(scheme) {
+		return Target{}, fmt.Errorf("%w: %q", ErrInvalidTarget, requestTarget)
+	}
+	authorityEnd := strings.IndexAny(rest, "/?")
+	if authorityEnd == -1 {
+		authorityEnd = len(rest)
+	}
+	authority := rest[:authorityEnd]
+	if authority == "" {
+		return Target{}, fmt.Errorf("%w: missing authority: %q", ErrInvalidTarget, requestTarget)
+	}
+
+	pathAndQuery := rest[authorityEnd:]
+	if !strings.HasPrefix(pathAndQuery, "/") {
+		pathAndQuery = "/" + pathAndQuery
+	}
+	target, err := parseOriginForm(pathAndQuery)
+	if err != nil {
+		return Target{}, err
+	}
+	target.Form = AbsoluteForm
+	target.Scheme = strings.ToLower(scheme)
+	target.Authority = authority
+	return target, nil
+}
+
+func parseOriginForm(requestTarget string) (Target, error) {
+	rawPath, rawQuery, _ := strings.Cut(requestTarget, "?")
+	path, err := unescape(rawPath, false)
+	if err != nil {
+		return Target{}, err
+	}
+	query, err := ParseQuery(rawQuery)
+	if err != nil {
+		return Target{}, err
+	}
+
+	return Target{
+		Form:     OriginForm,
+		Path:     path,
+		RawPath:  rawPath,
+		RawQuery: rawQuery,
+		Query:    query,
+	}, nil
+}
+
+// ParseQuery decodes an application/x-www-form-urlencoded string such as a
+// query into a map of values in the order they appear.
+func ParseQuery(rawQuery string) (map[string][]string, error) {
+	query := map[string][]string{}
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err := unescape(rawKey, true)
+		if err != nil {
+			return nil, err
+		}
+		value, err := unescape(rawValue, true)
+		if err != nil {
+			return nil, err
+		}
+		query[key] = append(query[key], value)
+	}
+	return query, nil
+}
+
+// PathUnescape decodes the percent-encoding in a path or path segment.
+// Unlike a query, "+" is left as is.
+func PathUnescape(s string) (string, error) {
+	return unescape(s, false)
+}
+
+// unescape decodes percent-encoding, and "+" as a space when plusAsSpace is
+// set, rejecting a "%" that is not followed by two hex digits.
+func unescape(s string, plusAsSpace bool) (string, error) {
+	if !strings.ContainsAny(s, "%+") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return "", fmt.Errorf("%w: malformed percent-encoding in %q", ErrInvalidTarget, s)
+			}
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		case s[i] == '+' && plusAsSpace:
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+func isAuthority(s string) bool {
+	host, port, ok := strings.Cut(s, ":")
+	if strings.HasPrefix(s, "[") {
+		end := strings.LastIndex(s, "]:")
+		if end == -1 {
+			return false
+		}
+		host, port, ok = s[:end+1], s[end+2:], true
+	}
+	return ok && host != "" && isDigits(port) && !strings.ContainsAny(host, "/?@")
+}
+
+func isScheme(s string) bool {
+	if s == "" || !isAlpha(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if !isAlpha(c) && !(c >= '0' && c <= '9') && c != '+' && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
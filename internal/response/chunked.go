@@ -0,0 +1,202 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrUndeclaredTrailer is returned by WriteTrailers for a field that was not
+// listed in the response's Trailer header.
+var ErrUndeclaredTrailer = errors.New("error: trailer field not declared in trailer header")
+
+// ChunkExtension is a chunk-ext sent after a chunk's size. Value may be
+// empty, and is quoted if it is not a token.
+type ChunkExtension struct {
+	Name  string
+	Value string
+}
+
+var crlf = []byte("\r\n")
+
+// WriteChunkedBody writes p as one chunk. It is WriteChunk without
+// extensions.
+func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	return w.WriteChunk(p)
+}
+
+// WriteChunk writes p as one chunk with the given extensions. The size line,
+// p and the closing CRLF are handed to the connection together without
+// copying p. An empty p is skipped, since a zero-size chunk would end the
+// body.
+func (w *Writer) WriteChunk(p []byte, extensions ...ChunkExtension) (int, error) {
+	err := w.checkChunked("wrote chunk")
+	if err != nil {
+		return 0, err
+	}
+	sizeLine, err := appendChunkSize(nil, len(p), extensions)
+	if err != nil {
+		return 0, err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if w.bodySuppressed() {
+		w.bodyWritten += len(p)
+		return len(p), nil
+	}
+
+	if w.unframed {
+		err = w.write(p)
+	} else {
+		err = w.writeBuffers(sizeLine, p, crlf)
+	}
+	if err != nil {
+		return 0, err
+	}
+	w.bodyWritten += len(p)
+	return len(p), nil
+}
+
+func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	err := w.checkChunked("ended chunked body")
+	if err != nil {
+		return 0, err
+	}
+	if w.bodySuppressed() || w.unframed {
+		w.state = trailersState
+		return 0, nil
+	}
+	lastChunk := []byte("0\r\n")
+	err = w.write(lastChunk)
+	if err != nil {
+		return 0, err
+	}
+	w.state = trailersState
+	return len(lastChunk), nil
+}
+
+// WriteTrailers ends a chunked body with trailer fields. Every field must
+// have been announced in the Trailer header, so the client knows to expect
+// it, or ErrUndeclaredTrailer is returned before anything is written.
+func (w *Writer) WriteTrailers(t *headers.Headers) error {
+	err := w.checkState(trailersState, "wrote trailers before chunked body was done")
+	if err != nil {
+		return err
+	}
+	err = validateFields(t)
+	if err != nil {
+		return err
+	}
+	for _, field := range t.Fields() {
+		if !slices.Contains(w.trailers, strings.ToLower(field.Name)) {
+			return fmt.Errorf("%w: %s", ErrUndeclaredTrailer, field.Name)
+		}
+	}
+
+	if w.bodySuppressed() || w.unframed {
+		w.state = doneState
+		return nil
+	}
+	err = w.writeHeadersLoop(t)
+	if err != nil {
+		return err
+	}
+	w.state = doneState
+	return nil
+}
+
+// checkChunked requires the headers to have been written with chunked
+// Transfer-Encoding and the body not to have been ended yet.
+func (w *Writer) checkChunked(attempt string) error {
+	err := w.checkState(bodyState, attempt+" outside of the body")
+	if err != nil {
+		return err
+	}
+	if !w.chunked {
+		return fmt.Errorf("%w: %s without chunked transfer-encoding", ErrInvalidState, attempt)
+	}
+	return nil
+}
+
+// writeBuffers writes bufs as one vectored write where the connection
+// supports it.
+func (w *Writer) writeBuffers(bufs ...[]byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	buffers := net.Buffers(bufs)
+	n, err := buffers.WriteTo(w.writer)
+	w.bytesWritten += int(n)
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+// appendChunkSize appends a chunk's size line: the size in hex, then each
+// extension as ";name" or ";name=value".
+func appendChunkSize(b []byte, size int, extensions []ChunkExtension) ([]byte, error) {
+	b = strconv.AppendInt(b, int64(size), 16)
+	for _, ext := range extensions {
+		err := headers.ValidateField(ext.Name, ext.Value)
+		if err != nil {
+			return nil, fmt.Errorf("error: invalid chunk extension: %w", err)
+		}
+		b = append(b, ';')
+		b = append(b, ext.Name...)
+		if ext.Value == "" {
+			continue
+		}
+		b = append(b, '=')
+		if isToken(ext.Value) {
+			b = append(b, ext.Value...)
+		} else {
+			b = appendQuoted(b, ext.Value)
+		}
+	}
+	return append(b, crlf...), nil
+}
+
+// appendQuoted appends s as a quoted-string, escaping quotes and
+// backslashes.
+func appendQuoted(b []byte, s string) []byte {
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b = append(b, '\\')
+		}
+		b = append(b, s[i])
+	}
+	return append(b, '"')
+}
+
+// isToken reports whether s can be sent without quoting.
+func isToken(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// declaredTrailers returns the lowercased field names listed in the Trailer
+// header.
+func declaredTrailers(h *headers.Headers) []string {
+	trailers := []string{}
+	for _, value := range h.Values("Trailer") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" {
+				trailers = append(trailers, strings.ToLower(name))
+			}
+		}
+	}
+	return trailers
+}
@@ -1,17 +1,56 @@
 package response
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"httpfromtcp/internal/headers"
 	"io"
-	"net"
 	"strconv"
+	"time"
+)
+
+// DefaultBufferThreshold is how much of a body Write holds back before
+// giving up on a Content-Length and switching to chunked encoding.
+const DefaultBufferThreshold = 4096
+
+var (
+	// ErrInvalidState is returned when a part of the response is written out
+	// of order, such as a body before the headers.
+	ErrInvalidState = errors.New("error: response written out of order")
+	// ErrBodyTooLong is returned when a body would exceed the Content-Length
+	// sent in the headers.
+	ErrBodyTooLong = errors.New("error: body exceeds content-length")
+	// ErrBodyTooShort is returned by Finish when fewer body bytes were
+	// written than the Content-Length promised.
+	ErrBodyTooShort = errors.New("error: body shorter than content-length")
 )
 
 type Writer struct {
-	writer io.Writer
-	state  writerState
+	writer  io.Writer
+	bw      *bufio.Writer
+	conn    deadlineSetter
+	state   writerState
+	version string
+	err     error
+
+	header          *headers.Headers
+	buf             []byte
+	bufferThreshold int
+	writeTimeout    time.Duration
+
+	closeConn     bool
+	suppressBody  bool
+	chunked       bool
+	unframed      bool
+	contentLength int
+	statusCode    StatusCode
+	bodyWritten   int
+	bytesWritten  int
+	headerHooks   []func(h *headers.Headers)
+	finishHooks   []func()
+	trailers      []string
+	eventStream   *EventStream
 }
 
 type writerState int
@@ -21,73 +60,356 @@ const (
 	headersState
 	bodyState
 	trailersState
+	doneState
 )
 
-func NewWriter(conn net.Conn) *Writer {
+// deadlineSetter is implemented by connections that support write
+// deadlines, such as net.Conn.
+type deadlineSetter interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+func NewWriter(writer io.Writer) *Writer {
+	conn, _ := writer.(deadlineSetter)
 	return &Writer{
-		writer: conn,
-		state:  statusLineState,
+		writer:          writer,
+		conn:            conn,
+		state:           statusLineState,
+		version:         "1.1",
+		header:          headers.NewHeaders(),
+		bufferThreshold: DefaultBufferThreshold,
+		contentLength:   -1,
+	}
+}
+
+// Header returns the headers that Write and Finish send with the response.
+// They can be changed until the first body bytes are sent. WriteHeaders
+// ignores them and writes the headers it is given.
+func (w *Writer) Header() *headers.Headers {
+	return w.header
+}
+
+// SetBufferThreshold sets how many body bytes Write buffers before switching
+// to chunked encoding.
+func (w *Writer) SetBufferThreshold(n int) {
+	w.bufferThreshold = n
+}
+
+// SetWriteTimeout sets how long each write of a long-lived response, such as
+// an event stream, may take. The server sets it to its WriteTimeout. Zero
+// means no limit.
+func (w *Writer) SetWriteTimeout(d time.Duration) {
+	w.writeTimeout = d
+}
+
+// SetVersion sets the HTTP version written in the status line, to match the
+// client's. HTTP/1.0 has no chunked encoding, so a chunked response to a 1.0
+// client is sent unframed and ended by closing the connection.
+func (w *Writer) SetVersion(version string) {
+	w.version = version
+}
+
+// SetConnectionClose marks this response as the last one on the connection.
+// A "connection: close" header is added when the headers are written.
+func (w *Writer) SetConnectionClose() {
+	w.closeConn = true
+}
+
+// SuppressBody makes the writer discard body bytes and chunk framing while
+// still writing the status line and headers, as a response to HEAD requires.
+// The server calls it for every HEAD request. 1xx, 204 and 304 responses,
+// which have no body, are suppressed without it.
+func (w *Writer) SuppressBody() {
+	w.suppressBody = true
+}
+
+// bodySuppressed reports whether body bytes are discarded, because of
+// SuppressBody or because the status code does not allow a body.
+func (w *Writer) bodySuppressed() bool {
+	return w.suppressBody || !w.statusCode.allowsBody()
+}
+
+// OnHeaders registers fn to be called with the response headers just before
+// they are written, so it can add or change fields. fn receives a copy of
+// the headers passed to WriteHeaders.
+func (w *Writer) OnHeaders(fn func(h *headers.Headers)) {
+	w.headerHooks = append(w.headerHooks, fn)
+}
+
+// OnFinish registers fn to be called once Finish has completed the response,
+// when the status code and body size are final. fn runs even if Finish
+// fails, but only the first time it is called.
+func (w *Writer) OnFinish(fn func()) {
+	w.finishHooks = append(w.finishHooks, fn)
+}
+
+// StatusCode returns the status code given to WriteStatusLine, or 0 if there
+// is none yet.
+func (w *Writer) StatusCode() StatusCode {
+	return w.statusCode
+}
+
+// BodyBytesWritten returns the number of body bytes the handler has written,
+// excluding chunk framing.
+func (w *Writer) BodyBytesWritten() int {
+	return w.bodyWritten
+}
+
+// BytesWritten returns the number of bytes written to the connection,
+// including the status line, headers and chunk framing.
+func (w *Writer) BytesWritten() int {
+	return w.bytesWritten
+}
+
+// HeadersSent reports whether the status line and headers have been written,
+// after which only the body and trailers can follow. The status line is held
+// back until then, so before that nothing of the final response has been
+// sent and it can still be replaced with Reset.
+func (w *Writer) HeadersSent() bool {
+	return w.state >= bodyState
+}
+
+// Reset discards the response the handler has prepared but not sent: the
+// status code, Header and anything Write has buffered. The server uses it to
+// answer with an error instead. Hooks registered with OnHeaders and OnFinish
+// are kept. It returns ErrInvalidState once the headers have been sent.
+func (w *Writer) Reset() error {
+	if w.HeadersSent() {
+		return fmt.Errorf("%w: reset response after sending headers", ErrInvalidState)
+	}
+	w.state = statusLineState
+	w.statusCode = 0
+	w.header = headers.NewHeaders()
+	w.buf = nil
+	return nil
+}
+
+// Err returns the error from the first failed write to the connection, if
+// any. Once a write has failed the response is broken and every later call
+// returns that error.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+// setWriteDeadline moves the connection's write deadline, if it has one.
+func (w *Writer) setWriteDeadline(t time.Time) {
+	if w.conn != nil {
+		w.conn.SetWriteDeadline(t)
+	}
+}
+
+// extendWriteDeadline gives the next write the full write timeout, for
+// responses that would otherwise run out of it while streaming.
+func (w *Writer) extendWriteDeadline() {
+	if w.writeTimeout > 0 {
+		w.setWriteDeadline(time.Now().Add(w.writeTimeout))
+	} else {
+		w.setWriteDeadline(time.Time{})
 	}
 }
 
-// type StatusCode int
+// write sends p to the connection, keeping count of the bytes written and
+// remembering the first error.
+func (w *Writer) write(p []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	n, err := w.writer.Write(p)
+	w.bytesWritten += n
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
 
-// const (
-// 	Code200 StatusCode = 200
-// 	Code400 StatusCode = 400
-// 	Code500 StatusCode = 500
-// )
+// checkState returns ErrInvalidState, with what was attempted, if the writer
+// is not in state, or the earlier write error if the response is broken.
+func (w *Writer) checkState(state writerState, attempt string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.state != state {
+		return fmt.Errorf("%w: %s", ErrInvalidState, attempt)
+	}
+	return nil
+}
 
-func GetStatusLine(statusCode int) string {
-	statusLine := "HTTP/1.1 "
-	switch statusCode {
-	case 200:
-		statusLine += "200 OK"
-	case 400:
-		statusLine += "400 Bad Request"
-	case 500:
-		statusLine += "500 Internal Server Error"
+// KeepAlive reports whether the connection can be reused once this response
+// has been written: neither side asked to close it and the response was
+// completely written with a known length.
+func (w *Writer) KeepAlive() bool {
+	if w.closeConn {
+		return false
+	}
+	switch {
+	case w.bodySuppressed():
+		return w.state >= bodyState
+	case w.chunked:
+		return w.state == doneState
+	case w.contentLength >= 0:
+		return w.state == bodyState && w.bodyWritten == w.contentLength
 	default:
-		statusLine += fmt.Sprintf("%v ", statusCode)
+		return false
 	}
-	return statusLine + "\r\n"
 }
 
-func (w *Writer) WriteStatusLine(statusCode int) error {
-	if w.state != statusLineState {
-		return errors.New("error: wrote status line after writing headers or body")
+func GetStatusLine(statusCode StatusCode) string {
+	return getStatusLine("1.1", statusCode)
+}
+
+// getStatusLine formats a status line. A code without a registered reason
+// phrase is written with an empty one, keeping the separating space.
+func getStatusLine(version string, statusCode StatusCode) string {
+	return "HTTP/" + version + " " + strconv.Itoa(int(statusCode)) + " " + statusCode.Reason() + "\r\n"
+}
+
+// WriteStatusLine sets the status code of the response. The status line is
+// sent together with the headers, so nothing reaches the client until
+// WriteHeaders, or Write's buffer is committed.
+func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	err := w.checkState(statusLineState, "wrote status line after writing headers or body")
+	if err != nil {
+		return err
 	}
-	statusLine := GetStatusLine(statusCode)
-	w.writer.Write([]byte(statusLine))
+	err = validateStatusCode(statusCode)
+	if err != nil {
+		return err
+	}
+	w.statusCode = statusCode
 	w.state = headersState
 	return nil
 }
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
+// WriteInformational writes a 1xx interim response, such as 100 Continue,
+// ahead of the final one, and flushes it so the client sees it at once. h
+// may be nil. It can be called any number of times before the headers are
+// sent, but never to an HTTP/1.0 client, which does not understand interim
+// responses.
+func (w *Writer) WriteInformational(statusCode StatusCode, h *headers.Headers) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.HeadersSent() {
+		return fmt.Errorf("%w: wrote informational response after the final status line", ErrInvalidState)
+	}
+	if !statusCode.Informational() {
+		return fmt.Errorf("error: %d is not an informational status code", statusCode)
+	}
+	if w.version == "1.0" {
+		return errors.New("error: informational responses are not sent to http/1.0 clients")
+	}
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	err := validateFields(h)
+	if err != nil {
+		return err
+	}
+
+	err = w.write([]byte(getStatusLine(w.version, statusCode)))
+	if err != nil {
+		return err
+	}
+	err = w.writeHeadersLoop(h)
+	if err != nil {
+		return err
+	}
+	return w.flush()
+}
+
+func GetDefaultHeaders(contentLen int) *headers.Headers {
 	h := headers.NewHeaders()
-	h["content-length"] = strconv.Itoa(contentLen)
-	h["connection"] = "close"
-	h["content-type"] = "text/plain"
+	h.Set("Content-Length", strconv.Itoa(contentLen))
+	h.Set("Content-Type", "text/plain")
 	return h
 }
 
-func (w *Writer) writeHeadersLoop(h headers.Headers) error {
-	for key, value := range h {
-		fieldLine := fmt.Sprintf("%s: %s\r\n", key, value)
-		_, err := w.writer.Write([]byte(fieldLine))
+func (w *Writer) writeFieldLines(h *headers.Headers) error {
+	for _, field := range h.Fields() {
+		err := w.writeFieldLine(field.Name, field.Value)
 		if err != nil {
 			return err
 		}
 	}
-	w.writer.Write([]byte("\r\n"))
 	return nil
 }
 
-func (w *Writer) WriteHeaders(headers headers.Headers) error {
-	if w.state != headersState {
-		return errors.New("error: wrote headers before writing status line or after writing body")
+func (w *Writer) writeFieldLine(name, value string) error {
+	return w.write([]byte(name + ": " + value + "\r\n"))
+}
+
+func (w *Writer) writeHeadersLoop(h *headers.Headers) error {
+	err := w.writeFieldLines(h)
+	if err != nil {
+		return err
+	}
+	return w.write([]byte("\r\n"))
+}
+
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
+	err := w.checkState(headersState, "wrote headers before writing status line or after writing body")
+	if err != nil {
+		return err
+	}
+
+	if len(w.headerHooks) > 0 {
+		h = h.Clone()
+		for _, fn := range w.headerHooks {
+			fn(h)
+		}
+	}
+
+	err = validateFields(h)
+	if err != nil {
+		return err
+	}
+
+	// 1xx and 204 responses must not have framing headers at all; 304 may
+	// repeat the Content-Length a 200 would have had.
+	if w.statusCode.Informational() || w.statusCode == Code204 {
+		h = h.Clone()
+		h.Del("Content-Length")
+		h.Del("Transfer-Encoding")
+	}
+	w.trailers = declaredTrailers(h)
+
+	if connection, ok := h.Get("Connection"); ok && headers.HasToken(connection, "close") {
+		w.closeConn = true
+	}
+	if transferEncoding, ok := h.Get("Transfer-Encoding"); ok && headers.HasToken(transferEncoding, "chunked") {
+		w.chunked = true
+		if w.version == "1.0" {
+			h = h.Clone()
+			h.Del("Transfer-Encoding")
+			h.Del("Trailer")
+			w.unframed = true
+			w.closeConn = true
+		}
+	} else if contentLength, ok := h.Get("Content-Length"); ok {
+		if n, err := strconv.Atoi(contentLength); err == nil && n >= 0 {
+			w.contentLength = n
+		}
+	}
+
+	err = w.write([]byte(getStatusLine(w.version, w.statusCode)))
+	if err != nil {
+		return err
+	}
+	err = w.writeFieldLines(h)
+	if err != nil {
+		return err
+	}
+	if _, ok := h.Get("Connection"); !ok {
+		if w.closeConn {
+			err = w.writeFieldLine("Connection", "close")
+		} else if w.version == "1.0" {
+			err = w.writeFieldLine("Connection", "keep-alive")
+		}
+		if err != nil {
+			return err
+		}
 	}
-	err := w.writeHeadersLoop(headers)
+	err = w.write([]byte("\r\n"))
 	if err != nil {
 		return err
 	}
@@ -95,34 +417,167 @@ func (w *Writer) WriteHeaders(headers headers.Headers) error {
 	return nil
 }
 
-func (w *Writer) WriteTrailers(t headers.Headers) error {
-	if w.state != trailersState {
-		return errors.New("error: wrote trailers before chunked body was done")
+// validateFields checks every field before any is written, so an invalid
+// value is reported instead of producing a corrupted message.
+func validateFields(h *headers.Headers) error {
+	for _, field := range h.Fields() {
+		err := headers.ValidateField(field.Name, field.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteBody writes body bytes as they are. It returns ErrBodyTooLong instead
+// of writing past the Content-Length, and ErrInvalidState for a chunked
+// response, whose body must go through WriteChunkedBody.
+func (w *Writer) WriteBody(p []byte) (int, error) {
+	err := w.checkState(bodyState, "wrote body before writing both status line and headers")
+	if err != nil {
+		return 0, err
+	}
+	if w.chunked {
+		return 0, fmt.Errorf("%w: wrote unframed body to a chunked response", ErrInvalidState)
 	}
-	err := w.writeHeadersLoop(t)
+	if w.contentLength >= 0 && w.bodyWritten+len(p) > w.contentLength {
+		return 0, fmt.Errorf("%w: %d bytes after %d of %d", ErrBodyTooLong, len(p), w.bodyWritten, w.contentLength)
+	}
+	if w.bodySuppressed() {
+		w.bodyWritten += len(p)
+		return len(p), nil
+	}
+	err = w.write(p)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	w.bodyWritten += len(p)
+	return len(p), nil
 }
 
-func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
-	content := []byte(fmt.Sprintf("%X\r\n%s\r\n", len(p), p))
-	return w.writer.Write(content)
+// Write implements io.Writer. It sets a 200 status if none was set, then
+// buffers the body so Finish can send it with a Content-Length. Once more
+// than the buffer threshold has been written the headers are sent with
+// chunked encoding, or with the Content-Length the handler set in Header,
+// and the rest of the body is streamed.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.state == statusLineState {
+		err := w.WriteStatusLine(Code200)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	switch w.state {
+	case headersState:
+		w.buf = append(w.buf, p...)
+		if len(w.buf) <= w.bufferThreshold {
+			return len(p), nil
+		}
+		err := w.commit(false)
+		if err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	case bodyState:
+		if w.chunked {
+			return w.WriteChunkedBody(p)
+		}
+		return w.WriteBody(p)
+	default:
+		return 0, fmt.Errorf("%w: wrote body after the body was done", ErrInvalidState)
+	}
 }
 
-func (w *Writer) WriteChunkedBodyDone() (int, error) {
-	w.state = trailersState
-	return w.writer.Write([]byte(fmt.Sprintf("%X\r\n", 0)))
+// commit writes the headers from Header followed by the buffered body. When
+// the body is complete its length is known and sent as Content-Length;
+// otherwise it is chunked unless the handler chose the framing itself. For a
+// HEAD request the length is that of the discarded body, as GET would send.
+// Responses that cannot have a body get no framing headers.
+func (w *Writer) commit(complete bool) error {
+	h := w.header
+	_, hasTransferEncoding := h.Get("Transfer-Encoding")
+	_, hasContentLength := h.Get("Content-Length")
+	switch {
+	case !w.statusCode.allowsBody():
+	case complete && !hasTransferEncoding:
+		h.Set("Content-Length", strconv.Itoa(len(w.buf)))
+	case !complete && !hasTransferEncoding && !hasContentLength:
+		h.Set("Transfer-Encoding", "chunked")
+	}
+
+	err := w.WriteHeaders(h)
+	if err != nil {
+		return err
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.chunked {
+		_, err = w.WriteChunkedBody(buf)
+	} else {
+		_, err = w.WriteBody(buf)
+	}
+	return err
 }
 
-func (w *Writer) WriteBody(p []byte) (int, error) {
-	if w.state != bodyState {
-		return 0, errors.New("error: wrote body before writing both status line and headers")
+// Finish completes the response, whichever way it was written: it sends a
+// 200 if nothing was set, sends the body buffered by Write with its
+// Content-Length, and ends a chunked body with empty trailers if the handler
+// did not, then flushes. It returns ErrBodyTooShort if a Content-Length
+// body was left incomplete. The server calls it once the handler returns.
+// An event stream whose client disconnected is left unended, and since the
+// stream already reported the write error, Finish returns nil.
+func (w *Writer) Finish() error {
+	err := w.finish()
+	hooks := w.finishHooks
+	w.finishHooks = nil
+	for _, fn := range hooks {
+		fn()
 	}
-	n, err := w.writer.Write(p)
+	return err
+}
+
+func (w *Writer) finish() error {
+	if w.eventStream != nil {
+		w.eventStream.Close()
+		if w.err != nil {
+			return nil
+		}
+	}
+	if w.state == statusLineState {
+		err := w.WriteStatusLine(Code200)
+		if err != nil {
+			return err
+		}
+	}
+	if w.state == headersState {
+		err := w.commit(true)
+		if err != nil {
+			return err
+		}
+	}
+	if w.state == bodyState && w.chunked {
+		_, err := w.WriteChunkedBodyDone()
+		if err != nil {
+			return err
+		}
+	}
+	if w.state == trailersState {
+		err := w.WriteTrailers(headers.NewHeaders())
+		if err != nil {
+			return err
+		}
+	}
+	err := w.flush()
 	if err != nil {
-		return 0, err
+		return err
 	}
-	return n, nil
+	if w.state == bodyState && !w.bodySuppressed() && w.bodyWritten < w.contentLength {
+		return fmt.Errorf("%w: %d of %d bytes written", ErrBodyTooShort, w.bodyWritten, w.contentLength)
+	}
+	return nil
 }
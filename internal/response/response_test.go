@@ -0,0 +1,686 @@
+package response
+
+import (
+	"bytes"
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHeaders(t *testing.T) {
+	// Test: Fields are written in insertion order with their original case
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	h := headers.NewHeaders()
+	h.Add("Content-Length", "0")
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	h.Add("x-custom", "value")
+	require.NoError(t, w.WriteStatusLine(200))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 0\r\n"+
+		"Set-Cookie: a=1\r\n"+
+		"Set-Cookie: b=2\r\n"+
+		"x-custom: value\r\n"+
+		"\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Connection close is added when requested
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetConnectionClose()
+	require.NoError(t, w.WriteStatusLine(200))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 0\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Connection: close\r\n"+
+		"\r\n", buf.String())
+	assert.False(t, w.KeepAlive())
+}
+
+func TestWriteHeadersRejectsInjection(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	h := GetDefaultHeaders(0)
+	h.Set("Location", "/next\r\nSet-Cookie: session=stolen")
+	require.NoError(t, w.WriteStatusLine(302))
+	buf.Reset()
+
+	err := w.WriteHeaders(h)
+	require.ErrorIs(t, err, headers.ErrInvalidFieldValue)
+	assert.Empty(t, buf.String())
+}
+
+func TestHTTP10Response(t *testing.T) {
+	// Test: Chunked response is sent unframed and closes the connection
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetVersion("1.0")
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteStatusLine(200))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n"+
+		"Connection: close\r\n"+
+		"\r\n"+
+		"hello", buf.String())
+	assert.False(t, w.KeepAlive())
+
+	// Test: Content-Length response announces keep-alive
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetVersion("1.0")
+	require.NoError(t, w.WriteStatusLine(200))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.Contains(t, buf.String(), "Connection: keep-alive\r\n")
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriteInformational(t *testing.T) {
+	// Test: Interim response precedes the final one
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteInformational(100, nil))
+	assert.False(t, w.HeadersSent())
+	require.NoError(t, w.WriteStatusLine(200))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n"+
+		"\r\n"+
+		"HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 0\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n", buf.String())
+
+	// Test: Only 1xx codes are accepted
+	w = NewWriter(&bytes.Buffer{})
+	assert.Error(t, w.WriteInformational(200, nil))
+
+	// Test: Allowed until the final status line is sent with the headers
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(200))
+	require.NoError(t, w.WriteInformational(100, nil))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.Error(t, w.WriteInformational(100, nil))
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\n"))
+
+	// Test: Not sent to HTTP/1.0 clients
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetVersion("1.0")
+	assert.Error(t, w.WriteInformational(100, nil))
+	assert.Empty(t, buf.String())
+}
+
+func TestStatusLine(t *testing.T) {
+	// Test: Registered codes carry their reason phrase
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", GetStatusLine(Code200))
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n", GetStatusLine(Code404))
+	assert.Equal(t, "HTTP/1.1 451 Unavailable For Legal Reasons\r\n", GetStatusLine(Code451))
+	assert.Equal(t, "HTTP/1.1 511 Network Authentication Required\r\n", GetStatusLine(Code511))
+
+	// Test: Unregistered codes keep the space before an empty reason phrase
+	assert.Equal(t, "HTTP/1.1 299 \r\n", GetStatusLine(299))
+
+	// Test: Codes that are not three digits are rejected before writing
+	for _, code := range []StatusCode{0, 99, 1000, -200} {
+		buf := &bytes.Buffer{}
+		w := NewWriter(buf)
+		assert.Error(t, w.WriteStatusLine(code))
+		assert.False(t, w.HeadersSent())
+		assert.Empty(t, buf.String())
+	}
+
+	// Test: Writer records the typed code
+	w := NewWriter(&bytes.Buffer{})
+	require.NoError(t, w.WriteStatusLine(Code201))
+	assert.Equal(t, Code201, w.StatusCode())
+	assert.Equal(t, "201 Created", w.StatusCode().String())
+}
+
+func TestBufferedWrite(t *testing.T) {
+	// Test: Small body is buffered and sent with its Content-Length
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Header().Set("Content-Type", "text/plain")
+	_, err := fmt.Fprintf(w, "hello %s", "world")
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+	assert.False(t, w.HeadersSent())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 11\r\n"+
+		"\r\n"+
+		"hello world", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Status line written by the handler is kept
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(Code404))
+	_, err = io.Copy(w, strings.NewReader("missing"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n"+
+		"Content-Length: 7\r\n"+
+		"\r\n"+
+		"missing", buf.String())
+
+	// Test: Crossing the threshold switches to chunked encoding
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetBufferThreshold(4)
+	_, err = w.Write([]byte("abc"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("de"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("fgh"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"5\r\nabcde\r\n"+
+		"3\r\nfgh\r\n"+
+		"0\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Content-Length set by the handler is used past the threshold
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetBufferThreshold(2)
+	w.Header().Set("Content-Length", "6")
+	_, err = w.Write([]byte("abc"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("def"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 6\r\n"+
+		"\r\n"+
+		"abcdef", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Finish without a body sends an empty 200
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 0\r\n"+
+		"\r\n", buf.String())
+
+	// Test: Finish ends a chunked body written with WriteChunkedBody
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteStatusLine(Code200))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hi"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"2\r\nhi\r\n"+
+		"0\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+}
+
+func TestReset(t *testing.T) {
+	// Test: Unsent status, headers and buffered body are discarded
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(Code204))
+	w.Header().Set("X-Partial", "yes")
+	_, err := w.Write([]byte("partial"))
+	require.NoError(t, err)
+	assert.False(t, w.HeadersSent())
+	require.NoError(t, w.Reset())
+	assert.Equal(t, StatusCode(0), w.StatusCode())
+	require.NoError(t, w.WriteStatusLine(Code500))
+	_, err = w.Write([]byte("oops"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 500 Internal Server Error\r\n"+
+		"Content-Length: 4\r\n"+
+		"\r\n"+
+		"oops", buf.String())
+
+	// Test: Not possible once the headers were sent
+	w = NewWriter(&bytes.Buffer{})
+	require.NoError(t, w.Flush())
+	assert.True(t, w.HeadersSent())
+	require.ErrorIs(t, w.Reset(), ErrInvalidState)
+}
+
+func TestBodySuppression(t *testing.T) {
+	// Test: HEAD response keeps the computed Content-Length without the body
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SuppressBody()
+	_, err := w.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 11\r\n"+
+		"\r\n", buf.String())
+	assert.Equal(t, 11, w.BodyBytesWritten())
+	assert.True(t, w.KeepAlive())
+
+	// Test: HEAD response past the threshold is chunked without chunks
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SuppressBody()
+	w.SetBufferThreshold(4)
+	_, err = w.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: 204 drops the body and any framing headers
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(Code204))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: 304 gets no computed Content-Length
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(Code304))
+	w.Header().Set("ETag", `"abc"`)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\n"+
+		"ETag: \"abc\"\r\n"+
+		"\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+}
+
+type failingWriter struct {
+	failAfter int
+	written   int
+}
+
+func (fw *failingWriter) Write(p []byte) (int, error) {
+	if fw.written+len(p) > fw.failAfter {
+		n := fw.failAfter - fw.written
+		fw.written = fw.failAfter
+		return n, io.ErrClosedPipe
+	}
+	fw.written += len(p)
+	return len(p), nil
+}
+
+func TestWriterState(t *testing.T) {
+	// Test: Chunks before headers are rejected
+	w := NewWriter(&bytes.Buffer{})
+	_, err := w.WriteChunkedBody([]byte("hi"))
+	require.ErrorIs(t, err, ErrInvalidState)
+	_, err = w.WriteChunkedBodyDone()
+	require.ErrorIs(t, err, ErrInvalidState)
+	require.ErrorIs(t, w.WriteHeaders(GetDefaultHeaders(0)), ErrInvalidState)
+	_, err = w.WriteBody([]byte("hi"))
+	require.ErrorIs(t, err, ErrInvalidState)
+	assert.False(t, w.HeadersSent())
+
+	// Test: Chunks need chunked transfer-encoding and vice versa
+	w = NewWriter(&bytes.Buffer{})
+	require.NoError(t, w.WriteStatusLine(Code200))
+	require.ErrorIs(t, w.WriteTrailers(headers.NewHeaders()), ErrInvalidState)
+	assert.False(t, w.HeadersSent())
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	assert.True(t, w.HeadersSent())
+	_, err = w.WriteChunkedBody([]byte("hi"))
+	require.ErrorIs(t, err, ErrInvalidState)
+	require.ErrorIs(t, w.WriteStatusLine(Code200), ErrInvalidState)
+
+	// Test: Body cannot exceed or fall short of Content-Length
+	_, err = w.WriteBody([]byte("h"))
+	require.NoError(t, err)
+	require.ErrorIs(t, w.Finish(), ErrBodyTooShort)
+	_, err = w.WriteBody([]byte("ey"))
+	require.ErrorIs(t, err, ErrBodyTooLong)
+	_, err = w.WriteBody([]byte("i"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Chunked body rejects unframed writes and chunks after the end
+	w = NewWriter(&bytes.Buffer{})
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteStatusLine(Code200))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteBody([]byte("hi"))
+	require.ErrorIs(t, err, ErrInvalidState)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("hi"))
+	require.ErrorIs(t, err, ErrInvalidState)
+	_, err = w.Write([]byte("hi"))
+	require.ErrorIs(t, err, ErrInvalidState)
+
+	// Test: Bytes written include framing
+	buf := &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(Code200))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, buf.Len(), w.BytesWritten())
+	assert.Equal(t, 5, w.BodyBytesWritten())
+}
+
+func TestWriterIOErrors(t *testing.T) {
+	statusLine := len("HTTP/1.1 200 OK\r\n")
+	headerBlock := len("Content-Length: 2\r\nContent-Type: text/plain\r\n")
+
+	// Test: Failed status line write is reported and the state is kept
+	w := NewWriter(&failingWriter{failAfter: 3})
+	require.NoError(t, w.WriteStatusLine(Code200))
+	require.ErrorIs(t, w.WriteHeaders(GetDefaultHeaders(2)), io.ErrClosedPipe)
+	assert.False(t, w.HeadersSent())
+	assert.Equal(t, 3, w.BytesWritten())
+
+	// Test: Failed final CRLF of the headers is reported
+	w = NewWriter(&failingWriter{failAfter: statusLine + headerBlock})
+	require.NoError(t, w.WriteStatusLine(Code200))
+	require.ErrorIs(t, w.WriteHeaders(GetDefaultHeaders(2)), io.ErrClosedPipe)
+	assert.False(t, w.HeadersSent())
+
+	// Test: Every call after a failure returns the same error
+	_, err := w.WriteBody([]byte("hi"))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+	require.ErrorIs(t, w.WriteHeaders(GetDefaultHeaders(2)), io.ErrClosedPipe)
+	require.ErrorIs(t, w.Finish(), io.ErrClosedPipe)
+	require.ErrorIs(t, w.Err(), io.ErrClosedPipe)
+
+	// Test: Failed body write is reported
+	w = NewWriter(&failingWriter{failAfter: statusLine + headerBlock + 3})
+	require.NoError(t, w.WriteStatusLine(Code200))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	_, err = w.WriteBody([]byte("hi"))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+	assert.Equal(t, 0, w.BodyBytesWritten())
+	assert.False(t, w.KeepAlive())
+}
+
+func TestChunkedEncoder(t *testing.T) {
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum, x-count")
+
+	// Test: Empty chunks are skipped and extensions follow the size
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(Code200))
+	require.NoError(t, w.WriteHeaders(h))
+	buf.Reset()
+	n, err := w.WriteChunkedBody([]byte{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	n, err = w.WriteChunk([]byte("0123456789abcdef!"), ChunkExtension{Name: "part", Value: "1"}, ChunkExtension{Name: "last"})
+	require.NoError(t, err)
+	assert.Equal(t, 17, n)
+	_, err = w.WriteChunk([]byte("x"), ChunkExtension{Name: "note", Value: `say "hi"`})
+	require.NoError(t, err)
+	_, err = w.WriteChunk([]byte("x"), ChunkExtension{Name: "bad name"})
+	require.Error(t, err)
+	_, err = w.WriteChunk([]byte("x"), ChunkExtension{Name: "n", Value: "a\r\nb"})
+	require.Error(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+
+	// Test: Declared trailers are written, case-insensitively
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Count", "2")
+	trailers.Set("x-checksum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "11;part=1;last\r\n0123456789abcdef!\r\n"+
+		"1;note=\"say \\\"hi\\\"\"\r\nx\r\n"+
+		"0\r\n"+
+		"X-Count: 2\r\n"+
+		"x-checksum: abc\r\n"+
+		"\r\n", buf.String())
+	assert.Equal(t, 18, w.BodyBytesWritten())
+
+	// Test: Undeclared trailer is rejected before anything is written
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(Code200))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	buf.Reset()
+	trailers = headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	trailers.Set("X-Other", "1")
+	require.ErrorIs(t, w.WriteTrailers(trailers), ErrUndeclaredTrailer)
+	assert.Empty(t, buf.String())
+	require.NoError(t, w.WriteTrailers(headers.NewHeaders()))
+	assert.Equal(t, "\r\n", buf.String())
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.String()
+}
+
+// deadlineWriter records the write deadlines it is given.
+type deadlineWriter struct {
+	bytes.Buffer
+	deadlines []time.Time
+}
+
+func (dw *deadlineWriter) SetWriteDeadline(t time.Time) error {
+	dw.deadlines = append(dw.deadlines, t)
+	return nil
+}
+
+func TestFlush(t *testing.T) {
+	// Test: Buffered writer holds everything until flushed
+	buf := &bytes.Buffer{}
+	w := NewBufferedWriter(buf, 1024)
+	require.NoError(t, w.WriteStatusLine(Code200))
+	w.Header().Set("Content-Type", "text/plain")
+	_, err := w.Write([]byte("first"))
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+
+	// Test: Flush sends the headers as chunked along with the body so far
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"5\r\nfirst\r\n", buf.String())
+
+	_, err = w.Write([]byte("second"))
+	require.NoError(t, err)
+	assert.NotContains(t, buf.String(), "second")
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "6\r\nsecond\r\n0\r\n\r\n"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Writes larger than the buffer go through
+	buf = &bytes.Buffer{}
+	w = NewBufferedWriter(buf, 16)
+	body := strings.Repeat("x", 100)
+	_, err = io.WriteString(w, body)
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "Content-Length: 100\r\n\r\n"+body))
+
+	// Test: Interim responses are flushed at once
+	buf = &bytes.Buffer{}
+	w = NewBufferedWriter(buf, 1024)
+	require.NoError(t, w.WriteInformational(Code100, nil))
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n", buf.String())
+}
+
+func TestStream(t *testing.T) {
+	// Test: Whole reader is streamed as chunks
+	buf := &bytes.Buffer{}
+	w := NewBufferedWriter(buf, 1024)
+	n, err := w.Stream(strings.NewReader("line one\nline two\n"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(18), n)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"12\r\nline one\nline two\n\r\n"+
+		"0\r\n\r\n", buf.String())
+
+	// Test: Data from a blocked reader is flushed on the interval
+	sb := &syncBuffer{}
+	w = NewBufferedWriter(sb, 1024)
+	pr, pw := io.Pipe()
+	done := make(chan error)
+	go func() {
+		_, err := w.Stream(pr, 10*time.Millisecond)
+		done <- err
+	}()
+	_, err = pw.Write([]byte("tick"))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return strings.HasSuffix(sb.String(), "4\r\ntick\r\n")
+	}, time.Second, 5*time.Millisecond)
+	pw.Close()
+	require.NoError(t, <-done)
+
+	// Test: Reader errors are returned
+	w = NewBufferedWriter(&bytes.Buffer{}, 1024)
+	_, err = w.Stream(io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(io.ErrUnexpectedEOF)), 0)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestEventStream(t *testing.T) {
+	// Test: Events are framed field by field, one chunk each
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	es, err := NewEventStream(w, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/event-stream\r\n"+
+		"Cache-Control: no-cache\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n", buf.String())
+	buf.Reset()
+	require.NoError(t, es.Send(Event{ID: "7", Event: "update", Data: "line one\nline two", Retry: 3 * time.Second}))
+	require.NoError(t, es.Send(Event{Data: "only data"}))
+	assert.Equal(t, "3f\r\nid: 7\nevent: update\nretry: 3000\ndata: line one\ndata: line two\n\n\r\n"+
+		"11\r\ndata: only data\n\n\r\n", buf.String())
+
+	// Test: Line breaks in single-line fields are rejected
+	require.ErrorIs(t, es.Send(Event{ID: "1\n2"}), ErrInvalidEvent)
+	require.ErrorIs(t, es.Send(Event{Event: "a\rb"}), ErrInvalidEvent)
+
+	// Test: Finish closes the stream and ends the body
+	require.NoError(t, w.Finish())
+	require.ErrorIs(t, es.Err(), ErrStreamClosed)
+	require.ErrorIs(t, es.Send(Event{Data: "late"}), ErrStreamClosed)
+	assert.True(t, strings.HasSuffix(buf.String(), "0\r\n\r\n"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Keep-alive comments are sent while idle
+	sb := &syncBuffer{}
+	w = NewWriter(sb)
+	es, err = NewEventStream(w, 5*time.Millisecond)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return strings.Contains(sb.String(), "e\r\n: keep-alive\n\n\r\n")
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, es.Close())
+
+	// Test: Client disconnect closes Done
+	fw := &failingWriter{failAfter: 200}
+	w = NewWriter(fw)
+	es, err = NewEventStream(w, 5*time.Millisecond)
+	require.NoError(t, err)
+	select {
+	case <-es.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stream did not notice the disconnect")
+	}
+	require.ErrorIs(t, es.Err(), io.ErrClosedPipe)
+	require.ErrorIs(t, es.Send(Event{Data: "gone"}), io.ErrClosedPipe)
+	require.NoError(t, es.Close())
+
+	// Test: Finish does not try to end the body of a disconnected stream
+	require.NoError(t, w.Finish())
+	assert.False(t, w.KeepAlive())
+
+	// Test: Each event gets the full write timeout
+	dw := &deadlineWriter{}
+	w = NewWriter(dw)
+	w.SetWriteTimeout(time.Minute)
+	es, err = NewEventStream(w, 0)
+	require.NoError(t, err)
+	require.NoError(t, es.Send(Event{Data: "one"}))
+	require.NoError(t, es.Close())
+	require.Len(t, dw.deadlines, 2)
+	for _, d := range dw.deadlines {
+		assert.WithinDuration(t, time.Now().Add(time.Minute), d, 5*time.Second)
+	}
+
+	// Test: No write timeout clears the deadline
+	dw = &deadlineWriter{}
+	w = NewWriter(dw)
+	_, err = NewEventStream(w, 0)
+	require.NoError(t, err)
+	require.Len(t, dw.deadlines, 1)
+	assert.True(t, dw.deadlines[0].IsZero())
+	require.NoError(t, w.Finish())
+
+	// Test: HEAD gets the headers and a stream that is already done
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SuppressBody()
+	es, err = NewEventStream(w, time.Millisecond)
+	require.NoError(t, err)
+	<-es.Done()
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "Transfer-Encoding: chunked\r\n\r\n"))
+}
@@ -0,0 +1,205 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultEventKeepAlive is how often NewEventStream sends a keep-alive
+// comment when given an interval of 0 or less.
+const DefaultEventKeepAlive = 15 * time.Second
+
+var (
+	// ErrInvalidEvent is returned by Send for an ID or event name containing
+	// a line break, which would end the field early.
+	ErrInvalidEvent = errors.New("error: invalid server-sent event")
+	// ErrStreamClosed is returned once the event stream has been closed.
+	ErrStreamClosed = errors.New("error: event stream closed")
+)
+
+// Event is one server-sent event. Empty fields are left out, and Data is
+// sent as one data line per line it contains.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// EventStream sends server-sent events as a text/event-stream response.
+// Each event is written as its own chunk and flushed at once. While the
+// stream is open no other method of the Writer may be used.
+type EventStream struct {
+	w *Writer
+
+	mu     sync.Mutex
+	err    error
+	done   chan struct{}
+	once   sync.Once
+	ticker *time.Ticker
+}
+
+// NewEventStream starts a text/event-stream response on w and sends its
+// headers. A comment is sent whenever keepAlive passes without an event, or
+// DefaultEventKeepAlive if keepAlive is 0 or less, so idle proxies keep the
+// connection open and a client that has gone away is noticed even when
+// there is nothing to send. Each write may take the Writer's write timeout,
+// counted afresh, so the stream can outlive it. The handler should stop
+// producing once Done is closed, and must Close the stream before it
+// returns.
+func NewEventStream(w *Writer, keepAlive time.Duration) (*EventStream, error) {
+	if w.HeadersSent() {
+		return nil, fmt.Errorf("%w: started event stream after sending headers", ErrInvalidState)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Del("Content-Length")
+	w.Header().Set("Transfer-Encoding", "chunked")
+	w.extendWriteDeadline()
+	err := w.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	es := &EventStream{
+		w:    w,
+		done: make(chan struct{}),
+	}
+	w.eventStream = es
+	if w.bodySuppressed() {
+		// A HEAD request gets the headers only, so there is nothing to
+		// produce.
+		es.stop(ErrStreamClosed)
+		return es, nil
+	}
+	if keepAlive <= 0 {
+		keepAlive = DefaultEventKeepAlive
+	}
+	es.ticker = time.NewTicker(keepAlive)
+	go es.keepAlive()
+	return es, nil
+}
+
+func (es *EventStream) keepAlive() {
+	for {
+		select {
+		case <-es.done:
+			return
+		case <-es.ticker.C:
+			es.Comment("keep-alive")
+		}
+	}
+}
+
+// Send writes ev to the client. It returns the write error if the client
+// has disconnected, after which Done is closed.
+func (es *EventStream) Send(ev Event) error {
+	if strings.ContainsAny(ev.ID, "\r\n\x00") {
+		return fmt.Errorf("%w: id contains a line break or null", ErrInvalidEvent)
+	}
+	if strings.ContainsAny(ev.Event, "\r\n") {
+		return fmt.Errorf("%w: event name contains a line break", ErrInvalidEvent)
+	}
+
+	b := []byte{}
+	if ev.ID != "" {
+		b = appendEventField(b, "id", ev.ID)
+	}
+	if ev.Event != "" {
+		b = appendEventField(b, "event", ev.Event)
+	}
+	if ev.Retry > 0 {
+		b = appendEventField(b, "retry", strconv.FormatInt(ev.Retry.Milliseconds(), 10))
+	}
+	if ev.Data != "" {
+		for _, line := range splitLines(ev.Data) {
+			b = appendEventField(b, "data", line)
+		}
+	}
+	return es.send(append(b, '\n'))
+}
+
+// Comment writes a comment line, which clients ignore.
+func (es *EventStream) Comment(text string) error {
+	b := []byte{}
+	for _, line := range splitLines(text) {
+		b = append(b, ": "...)
+		b = append(b, line...)
+		b = append(b, '\n')
+	}
+	return es.send(append(b, '\n'))
+}
+
+func (es *EventStream) send(p []byte) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.err != nil {
+		return es.err
+	}
+
+	es.w.extendWriteDeadline()
+	_, err := es.w.WriteChunk(p)
+	if err == nil {
+		err = es.w.flush()
+	}
+	if err != nil {
+		es.stop(err)
+	}
+	return err
+}
+
+// Done is closed when the client disconnects or the stream is closed.
+func (es *EventStream) Done() <-chan struct{} {
+	return es.done
+}
+
+// Err returns the error that ended the stream: the write error if the
+// client disconnected, ErrStreamClosed if it was closed, or nil while it is
+// open.
+func (es *EventStream) Err() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.err
+}
+
+// Close stops the keep-alive comments. The response is ended by the
+// Writer's Finish, which the server calls once the handler returns.
+func (es *EventStream) Close() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.err == nil {
+		es.stop(ErrStreamClosed)
+	}
+	return nil
+}
+
+// stop records why the stream ended and closes Done. es.mu must be held,
+// except before the stream is handed out.
+func (es *EventStream) stop(err error) {
+	es.once.Do(func() {
+		es.err = err
+		if es.ticker != nil {
+			es.ticker.Stop()
+		}
+		close(es.done)
+	})
+}
+
+func appendEventField(b []byte, name, value string) []byte {
+	b = append(b, name...)
+	b = append(b, ": "...)
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// splitLines splits s on any of the line endings an event stream accepts:
+// CRLF, LF or CR.
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,185 @@
+package response
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// StatusCode is a three-digit HTTP response status code.
+type StatusCode int
+
+// Status codes registered with IANA in the HTTP Status Code Registry.
+// Unused codes (306, 418) are left out.
+const (
+	Code100 StatusCode = 100 // Continue
+	Code101 StatusCode = 101 // Switching Protocols
+	Code102 StatusCode = 102 // Processing
+	Code103 StatusCode = 103 // Early Hints
+
+	Code200 StatusCode = 200 // OK
+	Code201 StatusCode = 201 // Created
+	Code202 StatusCode = 202 // Accepted
+	Code203 StatusCode = 203 // Non-Authoritative Information
+	Code204 StatusCode = 204 // No Content
+	Code205 StatusCode = 205 // Reset Content
+	Code206 StatusCode = 206 // Partial Content
+	Code207 StatusCode = 207 // Multi-Status
+	Code208 StatusCode = 208 // Already Reported
+	Code226 StatusCode = 226 // IM Used
+
+	Code300 StatusCode = 300 // Multiple Choices
+	Code301 StatusCode = 301 // Moved Permanently
+	Code302 StatusCode = 302 // Found
+	Code303 StatusCode = 303 // See Other
+	Code304 StatusCode = 304 // Not Modified
+	Code305 StatusCode = 305 // Use Proxy
+	Code307 StatusCode = 307 // Temporary Redirect
+	Code308 StatusCode = 308 // Permanent Redirect
+
+	Code400 StatusCode = 400 // Bad Request
+	Code401 StatusCode = 401 // Unauthorized
+	Code402 StatusCode = 402 // Payment Required
+	Code403 StatusCode = 403 // Forbidden
+	Code404 StatusCode = 404 // Not Found
+	Code405 StatusCode = 405 // Method Not Allowed
+	Code406 StatusCode = 406 // Not Acceptable
+	Code407 StatusCode = 407 // Proxy Authentication Required
+	Code408 StatusCode = 408 // Request Timeout
+	Code409 StatusCode = 409 // Conflict
+	Code410 StatusCode = 410 // Gone
+	Code411 StatusCode = 411 // Length Required
+	Code412 StatusCode = 412 // Precondition Failed
+	Code413 StatusCode = 413 // Content Too Large
+	Code414 StatusCode = 414 // URI Too Long
+	Code415 StatusCode = 415 // Unsupported Media Type
+	Code416 StatusCode = 416 // Range Not Satisfiable
+	Code417 StatusCode = 417 // Expectation Failed
+	Code421 StatusCode = 421 // Misdirected Request
+	Code422 StatusCode = 422 // Unprocessable Content
+	Code423 StatusCode = 423 // Locked
+	Code424 StatusCode = 424 // Failed Dependency
+	Code425 StatusCode = 425 // Too Early
+	Code426 StatusCode = 426 // Upgrade Required
+	Code428 StatusCode = 428 // Precondition Required
+	Code429 StatusCode = 429 // Too Many Requests
+	Code431 StatusCode = 431 // Request Header Fields Too Large
+	Code451 StatusCode = 451 // Unavailable For Legal Reasons
+
+	Code500 StatusCode = 500 // Internal Server Error
+	Code501 StatusCode = 501 // Not Implemented
+	Code502 StatusCode = 502 // Bad Gateway
+	Code503 StatusCode = 503 // Service Unavailable
+	Code504 StatusCode = 504 // Gateway Timeout
+	Code505 StatusCode = 505 // HTTP Version Not Supported
+	Code506 StatusCode = 506 // Variant Also Negotiates
+	Code507 StatusCode = 507 // Insufficient Storage
+	Code508 StatusCode = 508 // Loop Detected
+	Code510 StatusCode = 510 // Not Extended
+	Code511 StatusCode = 511 // Network Authentication Required
+)
+
+var reasonPhrases = map[StatusCode]string{
+	Code100: "Continue",
+	Code101: "Switching Protocols",
+	Code102: "Processing",
+	Code103: "Early Hints",
+
+	Code200: "OK",
+	Code201: "Created",
+	Code202: "Accepted",
+	Code203: "Non-Authoritative Information",
+	Code204: "No Content",
+	Code205: "Reset Content",
+	Code206: "Partial Content",
+	Code207: "Multi-Status",
+	Code208: "Already Reported",
+	Code226: "IM Used",
+
+	Code300: "Multiple Choices",
+	Code301: "Moved Permanently",
+	Code302: "Found",
+	Code303: "See Other",
+	Code304: "Not Modified",
+	Code305: "Use Proxy",
+	Code307: "Temporary Redirect",
+	Code308: "Permanent Redirect",
+
+	Code400: "Bad Request",
+	Code401: "Unauthorized",
+	Code402: "Payment Required",
+	Code403: "Forbidden",
+	Code404: "Not Found",
+	Code405: "Method Not Allowed",
+	Code406: "Not Acceptable",
+	Code407: "Proxy Authentication Required",
+	Code408: "Request Timeout",
+	Code409: "Conflict",
+	Code410: "Gone",
+	Code411: "Length Required",
+	Code412: "Precondition Failed",
+	Code413: "Content Too Large",
+	Code414: "URI Too Long",
+	Code415: "Unsupported Media Type",
+	Code416: "Range Not Satisfiable",
+	Code417: "Expectation Failed",
+	Code421: "Misdirected Request",
+	Code422: "Unprocessable Content",
+	Code423: "Locked",
+	Code424: "Failed Dependency",
+	Code425: "Too Early",
+	Code426: "Upgrade Required",
+	Code428: "Precondition Required",
+	Code429: "Too Many Requests",
+	Code431: "Request Header Fields Too Large",
+	Code451: "Unavailable For Legal Reasons",
+
+	Code500: "Internal Server Error",
+	Code501: "Not Implemented",
+	Code502: "Bad Gateway",
+	Code503: "Service Unavailable",
+	Code504: "Gateway Timeout",
+	Code505: "HTTP Version Not Supported",
+	Code506: "Variant Also Negotiates",
+	Code507: "Insufficient Storage",
+	Code508: "Loop Detected",
+	Code510: "Not Extended",
+	Code511: "Network Authentication Required",
+}
+
+// Reason returns the registered reason phrase for the code, or "" if the
+// code is not registered.
+func (c StatusCode) Reason() string {
+	return reasonPhrases[c]
+}
+
+// Valid reports whether the code has the three digits a status line
+// requires. Unregistered codes such as 299 are valid; a client treats them
+// as the x00 code of their class.
+func (c StatusCode) Valid() bool {
+	return c >= 100 && c <= 999
+}
+
+// Informational reports whether the code is a 1xx interim response.
+func (c StatusCode) Informational() bool {
+	return c >= 100 && c <= 199
+}
+
+// allowsBody reports whether a response with this code can carry a body.
+// 1xx, 204 and 304 responses never do.
+func (c StatusCode) allowsBody() bool {
+	return !c.Informational() && c != Code204 && c != Code304
+}
+
+func (c StatusCode) String() string {
+	if reason := c.Reason(); reason != "" {
+		return strconv.Itoa(int(c)) + " " + reason
+	}
+	return strconv.Itoa(int(c))
+}
+
+func validateStatusCode(c StatusCode) error {
+	if !c.Valid() {
+		return fmt.Errorf("error: invalid status code %d: must be three digits", int(c))
+	}
+	return nil
+}
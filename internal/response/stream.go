@@ -0,0 +1,150 @@
+package response
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"time"
+)
+
+// DefaultWriteBufferSize is the size of the buffer NewBufferedWriter puts in
+// front of the connection when given a size of 0 or less.
+const DefaultWriteBufferSize = 4096
+
+// NewBufferedWriter returns a Writer that collects small writes, such as
+// the status line, field lines and chunk framing, in a buffer of size bytes
+// and sends them to writer when it fills up, on Flush and on Finish.
+func NewBufferedWriter(writer io.Writer, size int) *Writer {
+	if size <= 0 {
+		size = DefaultWriteBufferSize
+	}
+	bw := bufio.NewWriterSize(writer, size)
+	w := NewWriter(bw)
+	w.bw = bw
+	w.conn, _ = writer.(deadlineSetter)
+	return w
+}
+
+// Flush sends everything written so far to the client. If the headers have
+// not been sent it sends them first, with a 200 status line if none was
+// written, and with chunked encoding unless Header has a Content-Length, so
+// a streaming handler can flush before it knows the body length.
+func (w *Writer) Flush() error {
+	if w.state == statusLineState {
+		err := w.WriteStatusLine(Code200)
+		if err != nil {
+			return err
+		}
+	}
+	if w.state == headersState {
+		err := w.commit(false)
+		if err != nil {
+			return err
+		}
+	}
+	return w.flush()
+}
+
+// flush pushes the write buffer, if any, to the connection.
+func (w *Writer) flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.bw == nil {
+		return nil
+	}
+	err := w.bw.Flush()
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+type readResult struct {
+	p   []byte
+	err error
+}
+
+// Stream copies r to the client as it is read, as chunks unless Header has
+// a Content-Length, and flushes whenever data has been waiting for
+// flushInterval, or after every read if flushInterval is 0. r is read one
+// chunk ahead of the client: a slow client blocks further reads, and a
+// source that blocks, such as a log tail, does not hold back what was
+// already read. Each write and flush may take the Writer's write timeout,
+// counted afresh, so the stream can outlive it. Stream returns at io.EOF
+// without ending the body, so trailers can still be written before Finish.
+// If writing fails, r may be left in a pending Read and should be closed by
+// the caller.
+func (w *Writer) Stream(r io.Reader, flushInterval time.Duration) (int64, error) {
+	w.extendWriteDeadline()
+	err := w.Flush()
+	if err != nil {
+		return 0, err
+	}
+
+	results := make(chan readResult)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			p := make([]byte, DefaultWriteBufferSize)
+			n, err := r.Read(p)
+			select {
+			case results <- readResult{p: p[:n], err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	if flushInterval > 0 {
+		ticker = time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	written := int64(0)
+	pending := false
+	for {
+		select {
+		case <-tick:
+			if !pending {
+				continue
+			}
+			w.extendWriteDeadline()
+			err := w.flush()
+			if err != nil {
+				return written, err
+			}
+			pending = false
+		case result := <-results:
+			w.extendWriteDeadline()
+			if len(result.p) > 0 {
+				n, err := w.Write(result.p)
+				written += int64(n)
+				if err != nil {
+					return written, err
+				}
+				pending = true
+			}
+			if errors.Is(result.err, io.EOF) {
+				return written, w.flush()
+			}
+			if result.err != nil {
+				return written, result.err
+			}
+			if flushInterval <= 0 {
+				err := w.flush()
+				if err != nil {
+					return written, err
+				}
+				pending = false
+			}
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package router
+
+import (
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"slices"
+	"strings"
+)
+
+// Router dispatches requests to handlers by method and path pattern. A
+// pattern is a path whose segments are either literals, "{name}" to capture
+// one segment, or a final "{name...}" to capture the rest of the path.
+// Routes are tried in the order they were registered.
+type Router struct {
+	routes []route
+}
+
+type route struct {
+	method   string
+	segments []segment
+	handler  server.Handler
+}
+
+type segment struct {
+	literal string
+	param   string
+	tail    bool
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+func (rt *Router) Handle(method, pattern string, handler server.Handler) {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+
+	rt.routes = append(rt.routes, route{
+		method:   method,
+		segments: segments,
+		handler:  handler,
+	})
+}
+
+func (rt *Router) Get(pattern string, handler server.Handler) {
+	rt.Handle("GET", pattern, handler)
+}
+
+func (rt *Router) Post(pattern string, handler server.Handler) {
+	rt.Handle("POST", pattern, handler)
+}
+
+func (rt *Router) Put(pattern string, handler server.Handler) {
+	rt.Handle("PUT", pattern, handler)
+}
+
+func (rt *Router) Patch(pattern string, handler server.Handler) {
+	rt.Handle("PATCH", pattern, handler)
+}
+
+func (rt *Router) Delete(pattern string, handler server.Handler) {
+	rt.Handle("DELETE", pattern, handler)
+}
+
+// Serve is a server.Handler that dispatches to the matching route. It
+// answers 404 when no pattern matches the path and 405 with an Allow header
+// when the path matches but the method does not. HEAD falls back to the GET
+// route, whose body the server discards, and OPTIONS without a route of its
+// own is answered with the allowed methods. Patterns are matched against the
+// path as sent, split on "/" before each segment is percent-decoded, so an
+// encoded "%2F" stays inside its segment and a parameter can contain "/".
+func (rt *Router) Serve(w *response.Writer, req *request.Request) *server.HandlerError {
+	method := req.RequestLine.Method
+	if req.Target.Form == request.AsteriskForm {
+		return rt.serveAsterisk(w, req)
+	}
+
+	allowed := []string{}
+	var getRoute *route
+	var getParams map[string]string
+	for i, route := range rt.routes {
+		params, ok := route.match(req.Target.RawPath)
+		if !ok {
+			continue
+		}
+
+		if route.method == method {
+			req.Params = params
+			return route.handler(w, req)
+		}
+
+		if route.method == "GET" && getRoute == nil {
+			getRoute = &rt.routes[i]
+			getParams = params
+		}
+		if !slices.Contains(allowed, route.method) {
+			allowed = append(allowed, route.method)
+		}
+	}
+
+	if len(allowed) == 0 {
+		return server.NewHandlerError(response.Code404, "not found")
+	}
+
+	if getRoute != nil && !slices.Contains(allowed, "HEAD") {
+		allowed = append(allowed, "HEAD")
+		if method == "HEAD" {
+			w.SuppressBody()
+			req.Params = getParams
+			return getRoute.handler(w, req)
+		}
+	}
+	if !slices.Contains(allowed, "OPTIONS") {
+		allowed = append(allowed, "OPTIONS")
+		if method == "OPTIONS" {
+			return writeOptions(w, allowed)
+		}
+	}
+
+	h := headers.NewHeaders()
+	h.Set("Allow", strings.Join(allowed, ", "))
+	return &server.HandlerError{
+		StatusCode: response.Code405,
+		Message:    "method not allowed",
+		Headers:    h,
+	}
+}
+
+// serveAsterisk answers "OPTIONS *", which asks about the server as a whole,
+// with every method any route accepts, including HEAD if a GET route can
+// serve it.
+func (rt *Router) serveAsterisk(w *response.Writer, req *request.Request) *server.HandlerError {
+	if req.RequestLine.Method != "OPTIONS" {
+		return server.NewHandlerError(response.Code400, "bad request")
+	}
+
+	allowed := []string{}
+	for _, route := range rt.routes {
+		if !slices.Contains(allowed, route.method) {
+			allowed = append(allowed, route.method)
+		}
+	}
+	if slices.Contains(allowed, "GET") && !slices.Contains(allowed, "HEAD") {
+		allowed = append(allowed, "HEAD")
+	}
+	if !slices.Contains(allowed, "OPTIONS") {
+		allowed = append(allowed, "OPTIONS")
+	}
+	return writeOptions(w, allowed)
+}
+
+func writeOptions(w *response.Writer, allowed []string) *server.HandlerError {
+	err := w.WriteStatusLine(response.Code204)
+	if err != nil {
+		return nil
+	}
+
+	h := headers.NewHeaders()
+	h.Set("Allow", strings.Join(allowed, ", "))
+	w.WriteHeaders(h)
+	return nil
+}
+
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("error: pattern must start with /: %s", pattern)
+	}
+
+	parts := strings.Split(pattern[1:], "/")
+	segments := make([]segment, 0, len(parts))
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			segments = append(segments, segment{literal: part})
+			continue
+		}
+
+		name := part[1 : len(part)-1]
+		tail := strings.HasSuffix(name, "...")
+		name = strings.TrimSuffix(name, "...")
+		if name == "" {
+			return nil, fmt.Errorf("error: empty parameter name in pattern: %s", pattern)
+		}
+		if tail && i != len(parts)-1 {
+			return nil, fmt.Errorf("error: wildcard must be the last segment: %s", pattern)
+		}
+		segments = append(segments, segment{param: name, tail: tail})
+	}
+
+	return segments, nil
+}
+
+func (r route) match(rawPath string) (map[string]string, bool) {
+	if !strings.HasPrefix(rawPath, "/") {
+		return nil, false
+	}
+
+	parts := strings.Split(rawPath[1:], "/")
+	params := map[string]string{}
+	for i, seg := range r.segments {
+		if i >= len(parts) {
+			return nil, false
+		}
+		if seg.tail {
+			value, err := request.PathUnescape(strings.Join(parts[i:], "/"))
+			if err != nil {
+				return nil, false
+			}
+			params[seg.param] = value
+			return params, true
+		}
+
+		part, err := request.PathUnescape(parts[i])
+		if err != nil {
+			return nil, false
+		}
+		if seg.param == "" {
+			if part != seg.literal {
+				return nil, false
+			}
+			continue
+		}
+		if part == "" {
+			return nil, false
+		}
+		params[seg.param] = part
+	}
+
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+	return params, true
+}
@@ -0,0 +1,136 @@
+package router
+
+import (
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouterMatch(t *testing.T) {
+	rt := New()
+	var got string
+	rt.Get("/users/{id}", func(w *response.Writer, req *request.Request) *server.HandlerError {
+		got = "user " + req.Param("id")
+		return nil
+	})
+	rt.Delete("/users/{id}", func(w *response.Writer, req *request.Request) *server.HandlerError {
+		got = "delete " + req.Param("id")
+		return nil
+	})
+	rt.Get("/static/{path...}", func(w *response.Writer, req *request.Request) *server.HandlerError {
+		got = "static " + req.Param("path")
+		return nil
+	})
+
+	// Test: Path parameter
+	handlerErr := serve(t, rt, "GET", "/users/42?verbose=1")
+	require.Nil(t, handlerErr)
+	assert.Equal(t, "user 42", got)
+
+	// Test: Method selects the route
+	handlerErr = serve(t, rt, "DELETE", "/users/7")
+	require.Nil(t, handlerErr)
+	assert.Equal(t, "delete 7", got)
+
+	// Test: Wildcard tail
+	handlerErr = serve(t, rt, "GET", "/static/css/site.css")
+	require.Nil(t, handlerErr)
+	assert.Equal(t, "static css/site.css", got)
+
+	// Test: HEAD falls back to GET
+	handlerErr = serve(t, rt, "HEAD", "/users/9")
+	require.Nil(t, handlerErr)
+	assert.Equal(t, "user 9", got)
+
+	// Test: Parameters are percent-decoded
+	handlerErr = serve(t, rt, "GET", "/users/j%C3%B6rg")
+	require.Nil(t, handlerErr)
+	assert.Equal(t, "user jörg", got)
+
+	// Test: Encoded slash stays inside its segment
+	handlerErr = serve(t, rt, "GET", "/users/a%2Fb")
+	require.Nil(t, handlerErr)
+	assert.Equal(t, "user a/b", got)
+
+	// Test: Encoded literal segment matches
+	handlerErr = serve(t, rt, "GET", "/%75sers/5")
+	require.Nil(t, handlerErr)
+	assert.Equal(t, "user 5", got)
+
+	// Test: Wildcard tail is decoded as a whole
+	handlerErr = serve(t, rt, "GET", "/static/a%20b/c%2Fd")
+	require.Nil(t, handlerErr)
+	assert.Equal(t, "static a b/c/d", got)
+
+	// Test: Unknown path
+	handlerErr = serve(t, rt, "GET", "/users")
+	require.NotNil(t, handlerErr)
+	assert.Equal(t, response.Code404, handlerErr.StatusCode)
+
+	// Test: Known path, wrong method
+	handlerErr = serve(t, rt, "POST", "/users/42")
+	require.NotNil(t, handlerErr)
+	assert.Equal(t, response.Code405, handlerErr.StatusCode)
+	allow, ok := handlerErr.Headers.Get("allow")
+	require.True(t, ok)
+	assert.Equal(t, "GET, DELETE, HEAD, OPTIONS", allow)
+}
+
+func TestRouterOptions(t *testing.T) {
+	rt := New()
+	rt.Post("/submit", func(w *response.Writer, req *request.Request) *server.HandlerError {
+		return nil
+	})
+
+	// Test: OPTIONS for a path
+	buf := &bytes.Buffer{}
+	handlerErr := rt.Serve(response.NewWriter(buf), newRequest(t, "OPTIONS", "/submit"))
+	require.Nil(t, handlerErr)
+	assert.Contains(t, buf.String(), "HTTP/1.1 204 No Content\r\n")
+	assert.Contains(t, buf.String(), "Allow: POST, OPTIONS\r\n")
+
+	// Test: OPTIONS for the whole server
+	buf = &bytes.Buffer{}
+	handlerErr = rt.Serve(response.NewWriter(buf), newRequest(t, "OPTIONS", "*"))
+	require.Nil(t, handlerErr)
+	assert.Contains(t, buf.String(), "Allow: POST, OPTIONS\r\n")
+	handlerErr = serve(t, rt, "HEAD", "/submit")
+	require.NotNil(t, handlerErr)
+	assert.Equal(t, response.Code405, handlerErr.StatusCode)
+
+	// Test: HEAD is listed once a GET route can serve it
+	rt.Get("/status", func(w *response.Writer, req *request.Request) *server.HandlerError {
+		return nil
+	})
+	buf = &bytes.Buffer{}
+	handlerErr = rt.Serve(response.NewWriter(buf), newRequest(t, "OPTIONS", "*"))
+	require.Nil(t, handlerErr)
+	assert.Contains(t, buf.String(), "Allow: POST, GET, HEAD, OPTIONS\r\n")
+}
+
+func TestParsePattern(t *testing.T) {
+	_, err := parsePattern("users")
+	require.Error(t, err)
+
+	_, err = parsePattern("/files/{path...}/edit")
+	require.Error(t, err)
+
+	_, err = parsePattern("/users/{}")
+	require.Error(t, err)
+}
+
+func serve(t *testing.T, rt *Router, method, target string) *server.HandlerError {
+	return rt.Serve(response.NewWriter(&bytes.Buffer{}), newRequest(t, method, target))
+}
+
+func newRequest(t *testing.T, method, target string) *request.Request {
+	req, err := request.RequestFromReader(strings.NewReader(method + " " + target + " HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	return req
+}
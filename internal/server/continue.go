@@ -0,0 +1,51 @@
+package server
+
+import (
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/response"
+	"io"
+)
+
+// continueReader sends 100 Continue the first time the body of an
+// "Expect: 100-continue" request is read, so the client only sends a body
+// the handler actually wants.
+type continueReader struct {
+	body io.ReadCloser
+	w    *response.Writer
+	sent bool
+}
+
+// expectContinue wraps the request body so reading it sends 100 Continue. A
+// handler that answers without reading the body rejects it, and since the
+// client may or may not send it anyway the connection is closed after the
+// response instead of being drained.
+func expectContinue(body io.ReadCloser, w *response.Writer) *continueReader {
+	cr := &continueReader{body: body, w: w}
+	w.OnHeaders(func(h *headers.Headers) {
+		if !cr.sent {
+			h.Set("Connection", "close")
+		}
+	})
+	return cr
+}
+
+func (cr *continueReader) Read(p []byte) (int, error) {
+	if !cr.sent {
+		cr.sent = true
+		if !cr.w.HeadersSent() {
+			err := cr.w.WriteInformational(response.Code100, nil)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return cr.body.Read(p)
+}
+
+// Close only drains the body if the client was told to send it.
+func (cr *continueReader) Close() error {
+	if !cr.sent {
+		return nil
+	}
+	return cr.body.Close()
+}
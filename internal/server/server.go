@@ -1,42 +1,246 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/headers"
 	"httpfromtcp/internal/request"
 	"httpfromtcp/internal/response"
+	"io"
 	"log"
 	"net"
+	"os"
+	"runtime/debug"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
+)
+
+const (
+	lingerTimeout  = 500 * time.Millisecond
+	maxLingerBytes = 256 << 10
 )
 
 type Handler func(w *response.Writer, req *request.Request) *HandlerError
 
+// Middleware wraps a Handler with behaviour that runs around it.
+type Middleware func(next Handler) Handler
+
+// Chain wraps handler with middlewares so that the first middleware is the
+// outermost: it sees the request first and the result last.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Compose combines middlewares into one, applied in the same order as Chain.
+func Compose(middlewares ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		return Chain(next, middlewares...)
+	}
+}
+
+// HandlerError is returned by a Handler that has not written a response to
+// have the server write an error response for it. Message is sent as the
+// body with ContentType (text/plain if empty), and Headers are added to the
+// defaults. A zero StatusCode is sent as 500.
 type HandlerError struct {
-	Message string
+	StatusCode  response.StatusCode
+	Message     string
+	ContentType string
+	Headers     *headers.Headers
+}
+
+func NewHandlerError(statusCode response.StatusCode, message string) *HandlerError {
+	return &HandlerError{
+		StatusCode: statusCode,
+		Message:    message,
+	}
+}
+
+func (he *HandlerError) Error() string {
+	return fmt.Sprintf("handler error: %d: %s", he.Status(), he.Message)
+}
+
+// Status returns the status code the error is sent with.
+func (he *HandlerError) Status() response.StatusCode {
+	if he.StatusCode == 0 {
+		return response.Code500
+	}
+	return he.StatusCode
 }
 
-// func (he *HandlerError) write(w io.Writer) {
-// 	response.WriteStatusLine(w, he.StatusCode)
-// 	h := response.GetDefaultHeaders(len(he.Message))
-// 	response.WriteHeaders(w, h)
-// 	w.Write([]byte(he.Message))
-// }
+// write replaces whatever the handler prepared but did not send with the
+// error response.
+func (he *HandlerError) write(w *response.Writer) error {
+	err := w.Reset()
+	if err != nil {
+		return err
+	}
+	err = w.WriteStatusLine(he.Status())
+	if err != nil {
+		return err
+	}
+
+	h := response.GetDefaultHeaders(len(he.Message))
+	if he.ContentType != "" {
+		h.Override("content-type", he.ContentType)
+	}
+	if he.Headers != nil {
+		for _, field := range he.Headers.Fields() {
+			h.Del(field.Name)
+		}
+		for _, field := range he.Headers.Fields() {
+			h.Add(field.Name, field.Value)
+		}
+	}
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.WriteBody([]byte(he.Message))
+	if err != nil {
+		return err
+	}
+	return w.Finish()
+}
 
 type Server struct {
+	// StreamRequestBody hands handlers the request body through
+	// Request.BodyReader as it arrives instead of buffering it into
+	// Request.Body first. It also lets a handler refuse an "Expect:
+	// 100-continue" upload before the client sends the body.
+	StreamRequestBody bool
+
+	// Limits bounds the size of incoming requests. New sets it to
+	// request.DefaultLimits.
+	Limits request.Limits
+
+	// ReadHeaderTimeout bounds reading the request line and headers. If zero,
+	// ReadTimeout is used. Exceeding it is answered with 408 Request Timeout.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading the whole request, including the body.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing the response, counted from the end of the
+	// request headers. An event stream instead allows it for each event, and
+	// Writer.Stream for each chunk it writes or flushes.
+	WriteTimeout time.Duration
+	// IdleTimeout bounds the wait for the next request on a keep-alive
+	// connection. If zero, ReadTimeout is used.
+	IdleTimeout time.Duration
+
+	// WriteBufferSize is the size of the buffer responses are written
+	// through. Handlers call Flush on the response.Writer to send what it
+	// holds early. If zero, response.DefaultWriteBufferSize is used.
+	WriteBufferSize int
+
 	closed atomic.Bool
 
 	listener net.Listener
 	handler  Handler
+
+	mu    sync.Mutex
+	conns map[net.Conn]connState
+	wg    sync.WaitGroup
 }
 
+type connState int
+
+const (
+	connIdle connState = iota
+	connActive
+)
+
+// Close stops accepting connections and closes every open connection,
+// including those with a request in flight. Use Shutdown to let them finish.
 func (s *Server) Close() error {
+	err := s.stopListening()
+	s.closeConns(false)
+	return err
+}
+
+// Shutdown stops accepting connections, closes idle keep-alive connections
+// and waits for in-flight requests to finish. If ctx is done first, the
+// remaining connections are closed and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.stopListening()
+	s.closeConns(true)
+
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return err
+	case <-ctx.Done():
+		s.closeConns(false)
+		return ctx.Err()
+	}
+}
+
+func (s *Server) stopListening() error {
+	s.mu.Lock()
 	s.closed.Store(true)
+	s.mu.Unlock()
+
 	if s.listener != nil {
 		return s.listener.Close()
 	}
 	return nil
 }
 
+func (s *Server) closeConns(idleOnly bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, state := range s.conns {
+		if idleOnly && state != connIdle {
+			continue
+		}
+		conn.Close()
+	}
+}
+
+// trackConn registers a new connection, reporting false if the server is
+// already shutting down.
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed.Load() {
+		return false
+	}
+	s.conns[conn] = connIdle
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// setConnState records whether conn has a request in flight. It reports
+// false when the connection is going idle during shutdown and should be
+// closed instead.
+func (s *Server) setConnState(conn net.Conn, state connState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state == connIdle && s.closed.Load() {
+		return false
+	}
+	s.conns[conn] = state
+	return true
+}
+
 func (s *Server) listen() {
 	for {
 		conn, err := s.listener.Accept()
@@ -49,55 +253,226 @@ func (s *Server) listen() {
 			}
 		}
 
+		if !s.trackConn(conn) {
+			conn.Close()
+			return
+		}
 		go s.handle(conn)
 	}
 }
 
 func (s *Server) handle(conn net.Conn) {
+	defer s.untrackConn(conn)
 	defer conn.Close()
 
-	w := response.NewWriter(conn)
-	req, err := request.RequestFromReader(conn)
+	var w *response.Writer
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("panic serving %s: %v\n%s", conn.RemoteAddr(), v, debug.Stack())
+			if w != nil && !w.HeadersSent() {
+				w.SetConnectionClose()
+				NewHandlerError(response.Code500, "internal server error").write(w)
+			}
+		}
+	}()
+
+	reader := request.NewReader(conn)
+	reader.StreamBody = true
+	reader.Limits = s.Limits
+	start := time.Now()
+	for first := true; ; first = false {
+		if first {
+			conn.SetReadDeadline(deadline(start, s.readHeaderTimeout()))
+		} else {
+			conn.SetReadDeadline(deadline(time.Now(), s.idleTimeout()))
+		}
+		err := reader.WaitForRequest()
+		if err != nil {
+			return
+		}
+		if !s.setConnState(conn, connActive) {
+			return
+		}
+		if !first {
+			start = time.Now()
+		}
+
+		w = response.NewBufferedWriter(conn, s.WriteBufferSize)
+		w.SetWriteTimeout(s.WriteTimeout)
+		req, err := s.readRequest(conn, reader, w, start)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			conn.SetWriteDeadline(deadline(time.Now(), s.WriteTimeout))
+			writeParseError(w, err)
+			closeWriteAndDrain(conn)
+			return
+		}
+
+		w.SetVersion(req.RequestLine.HttpVersion)
+		if req.RequestLine.Method == "HEAD" {
+			w.SuppressBody()
+		}
+		if !req.KeepAlive() || s.closed.Load() {
+			w.SetConnectionClose()
+		}
+
+		handlerErr := s.handler(w, req)
+		if handlerErr != nil {
+			if w.HeadersSent() {
+				log.Printf("%s after response was started, closing connection", handlerErr)
+				return
+			}
+			err = handlerErr.write(w)
+			if err != nil {
+				log.Printf("error writing handler error response: %s", err)
+				return
+			}
+		} else {
+			err = w.Finish()
+			if err != nil {
+				log.Printf("error finishing response: %s", err)
+				return
+			}
+		}
+
+		if !w.KeepAlive() {
+			closeWriteAndDrain(conn)
+			return
+		}
+		err = req.BodyReader.Close()
+		if err != nil || !s.setConnState(conn, connIdle) {
+			closeWriteAndDrain(conn)
+			return
+		}
+	}
+}
+
+// readRequest reads the next request under ReadHeaderTimeout, then extends
+// the read deadline to ReadTimeout for the body and starts the WriteTimeout
+// for the response. Both read timeouts count from start. A client expecting
+// 100 Continue gets it from w once the body is first read.
+func (s *Server) readRequest(conn net.Conn, reader *request.Reader, w *response.Writer, start time.Time) (*request.Request, error) {
+	conn.SetReadDeadline(deadline(start, s.readHeaderTimeout()))
+	req, err := reader.ReadRequest()
 	if err != nil {
-		w.WriteStatusLine(500)
-		body := []byte("could not parse request")
-		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
-		w.WriteBody(body)
-		return
+		return nil, err
+	}
+	expect, err := req.ExpectsContinue()
+	if err != nil {
+		return nil, err
+	}
+	if expect {
+		req.BodyReader = expectContinue(req.BodyReader, w)
 	}
 
-	handlerErr := s.handler(w, req)
-	if handlerErr != nil {
+	conn.SetReadDeadline(deadline(start, s.ReadTimeout))
+	conn.SetWriteDeadline(deadline(time.Now(), s.WriteTimeout))
+	if !s.StreamRequestBody {
+		err = req.ReadBody()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// The body is drained once the handler returns. If too much of it
+		// is left for that, the client has to be told in the headers that
+		// the connection will close.
+		w.OnHeaders(func(h *headers.Headers) {
+			if !req.BodyDrainable() {
+				w.SetConnectionClose()
+			}
+		})
+	}
+	return req, nil
+}
 
+func (s *Server) readHeaderTimeout() time.Duration {
+	if s.ReadHeaderTimeout != 0 {
+		return s.ReadHeaderTimeout
 	}
+	return s.ReadTimeout
+}
 
-	// headers := response.GetDefaultHeaders(len(buf.Bytes()))
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout != 0 {
+		return s.IdleTimeout
+	}
+	return s.ReadTimeout
+}
 
-	// err = response.WriteStatusLine(conn, response.Code200)
-	// if err != nil {
-	// 	log.Printf("error writing status line: %s", err)
-	// 	conn.Close()
-	// }
+// deadline returns the time timeout after start, or the zero time (no
+// deadline) when timeout is zero.
+func deadline(start time.Time, timeout time.Duration) time.Time {
+	if timeout == 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}
 
-	// err = response.WriteHeaders(conn, headers)
-	// if err != nil {
-	// 	log.Printf("error writing headers: %s", err)
-	// 	conn.Close()
-	// }
+// closeWriteAndDrain half-closes conn and discards what the client is still
+// sending for a short while. Closing with unread data makes the kernel reset
+// the connection, which can destroy the last response before the client
+// reads it.
+func closeWriteAndDrain(conn net.Conn) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	tcpConn.CloseWrite()
+	tcpConn.SetReadDeadline(time.Now().Add(lingerTimeout))
+	io.CopyN(io.Discard, tcpConn, maxLingerBytes)
+}
 
-	// conn.Write(buf.Bytes())
+// writeParseError answers a request that could not be read with the status
+// its error carries: 4xx for client mistakes, 501 or 505 for what the server
+// does not support, 408 for a timeout and 500 for anything else.
+func writeParseError(w *response.Writer, err error) {
+	statusCode := response.Code500
+	body := []byte("could not parse request")
+	var parseErr *headers.ParseError
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		statusCode = response.Code408
+		body = []byte("request timeout")
+	case errors.As(err, &parseErr):
+		statusCode = response.StatusCode(parseErr.StatusCode())
+		body = []byte(err.Error())
+	}
+
+	w.SetConnectionClose()
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+	w.Finish()
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
+// New returns a Server that is configured but not yet listening, so its
+// settings can be changed before calling Listen.
+func New(handler Handler) *Server {
+	return &Server{
+		Limits:  request.DefaultLimits,
+		handler: handler,
+		conns:   make(map[net.Conn]connState),
+	}
+}
+
+func (s *Server) Listen(port int) error {
 	listener, err := net.Listen("tcp", "localhost:"+strconv.Itoa(port))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	s := &Server{
-		listener: listener,
-		handler:  handler,
-	}
+	s.listener = listener
 	go s.listen()
+	return nil
+}
+
+func Serve(port int, handler Handler) (*Server, error) {
+	s := New(handler)
+	err := s.Listen(port)
+	if err != nil {
+		return nil, err
+	}
 	return s, nil
 }
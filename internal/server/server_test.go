@@ -0,0 +1,383 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer starts s on a free port and returns its address. The server
+// is closed when the test ends.
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	require.NoError(t, s.Listen(0))
+	t.Cleanup(func() { s.Close() })
+	return s.listener.Addr().String()
+}
+
+// dial connects to addr with a deadline so a test that waits for the
+// wrong thing fails instead of hanging.
+func dial(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+// readResponse reads one response and its body from br.
+func readResponse(t *testing.T, br *bufio.Reader) (*http.Response, string) {
+	t.Helper()
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	return res, string(body)
+}
+
+func TestHandlerErrorAfterWrite(t *testing.T) {
+	s := New(func(w *response.Writer, req *request.Request) *HandlerError {
+		w.WriteStatusLine(response.Code201)
+		w.Header().Set("X-Partial", "yes")
+		w.Write([]byte("partial"))
+		return NewHandlerError(response.Code503, "unavailable")
+	})
+	addr := startServer(t, s)
+
+	// Test: Buffered output is replaced by the error response
+	conn, br := dial(t, addr)
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	res, body := readResponse(t, br)
+	assert.Equal(t, 503, res.StatusCode)
+	assert.Empty(t, res.Header.Get("X-Partial"))
+	assert.Equal(t, "unavailable", body)
+}
+
+func TestContinueAfterWrite(t *testing.T) {
+	s := New(func(w *response.Writer, req *request.Request) *HandlerError {
+		w.Write([]byte("got "))
+		io.Copy(w, req.BodyReader)
+		return nil
+	})
+	s.StreamRequestBody = true
+	addr := startServer(t, s)
+
+	// Test: 100 Continue is sent when the handler reads the body after
+	// buffering some output
+	conn, br := dial(t, addr)
+	_, err := io.WriteString(conn, "POST / HTTP/1.1\r\nHost: localhost\r\n"+
+		"Content-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	require.NoError(t, err)
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", line)
+	line, err = br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", line)
+	_, err = io.WriteString(conn, "hello")
+	require.NoError(t, err)
+	res, body := readResponse(t, br)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "got hello", body)
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s := New(func(w *response.Writer, req *request.Request) *HandlerError {
+		if req.RequestLine.RequestTarget == "/slow" {
+			close(started)
+			<-release
+		}
+		w.Write([]byte("done"))
+		return nil
+	})
+	addr := startServer(t, s)
+
+	// Test: Idle keep-alive connections are closed and in-flight handlers
+	// finish
+	idle, idleReader := dial(t, addr)
+	_, err := io.WriteString(idle, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	res, _ := readResponse(t, idleReader)
+	assert.Equal(t, 200, res.StatusCode)
+
+	busy, busyReader := dial(t, addr)
+	_, err = io.WriteString(busy, "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	shutdownErr := make(chan error)
+	go func() {
+		shutdownErr <- s.Shutdown(context.Background())
+	}()
+	_, err = idleReader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	close(release)
+	res, body := readResponse(t, busyReader)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "done", body)
+	_, err = busyReader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	require.NoError(t, <-shutdownErr)
+
+	// Test: New connections are refused
+	_, err = net.Dial("tcp", addr)
+	assert.Error(t, err)
+}
+
+func TestShutdownContextExpires(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	s := New(func(w *response.Writer, req *request.Request) *HandlerError {
+		close(started)
+		<-release
+		return nil
+	})
+	addr := startServer(t, s)
+
+	// Test: Remaining connections are force-closed and ctx's error returned
+	conn, br := dial(t, addr)
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	_, err = br.ReadByte()
+	assert.Error(t, err)
+}
+
+func TestTimeouts(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) *HandlerError {
+		if req.RequestLine.RequestTarget == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte("ok"))
+		return nil
+	}
+
+	// Test: Headers that do not arrive in time get 408
+	s := New(handler)
+	s.ReadHeaderTimeout = 50 * time.Millisecond
+	addr := startServer(t, s)
+	conn, br := dial(t, addr)
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: local")
+	require.NoError(t, err)
+	res, body := readResponse(t, br)
+	assert.Equal(t, 408, res.StatusCode)
+	assert.Equal(t, "request timeout", body)
+	assert.True(t, res.Close)
+
+	// Test: An idle keep-alive connection is closed without a response
+	s = New(handler)
+	s.IdleTimeout = 50 * time.Millisecond
+	addr = startServer(t, s)
+	conn, br = dial(t, addr)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	res, _ = readResponse(t, br)
+	assert.Equal(t, 200, res.StatusCode)
+	start := time.Now()
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Test: ReadTimeout covers the body
+	s = New(handler)
+	s.ReadTimeout = 100 * time.Millisecond
+	addr = startServer(t, s)
+	conn, br = dial(t, addr)
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nabc")
+	require.NoError(t, err)
+	res, _ = readResponse(t, br)
+	assert.Equal(t, 408, res.StatusCode)
+
+	// Test: WriteTimeout cuts off a response that is written too late
+	s = New(handler)
+	s.WriteTimeout = 50 * time.Millisecond
+	addr = startServer(t, s)
+	conn, br = dial(t, addr)
+	_, err = io.WriteString(conn, "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestHandlerPanic(t *testing.T) {
+	s := New(func(w *response.Writer, req *request.Request) *HandlerError {
+		switch req.RequestLine.RequestTarget {
+		case "/before":
+			panic("before writing")
+		case "/buffered":
+			w.Write([]byte("partial"))
+			panic("after buffering")
+		case "/after":
+			w.Write([]byte("partial"))
+			w.Flush()
+			panic("after writing")
+		}
+		w.Write([]byte("ok"))
+		return nil
+	})
+	addr := startServer(t, s)
+
+	// Test: A panic before anything was sent gets a 500 and closes
+	for _, target := range []string{"/before", "/buffered"} {
+		conn, br := dial(t, addr)
+		_, err := io.WriteString(conn, "GET "+target+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		require.NoError(t, err)
+		res, body := readResponse(t, br)
+		assert.Equal(t, 500, res.StatusCode)
+		assert.Equal(t, "internal server error", body)
+		assert.True(t, res.Close)
+		_, err = br.ReadByte()
+		assert.ErrorIs(t, err, io.EOF)
+	}
+
+	// Test: A panic after the headers were sent closes the connection
+	conn, br := dial(t, addr)
+	_, err := io.WriteString(conn, "GET /after HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	_, err = io.ReadAll(res.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Other clients are still served
+	conn, br = dial(t, addr)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	res, body := readResponse(t, br)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "ok", body)
+}
+
+func TestKeepAlive(t *testing.T) {
+	s := New(func(w *response.Writer, req *request.Request) *HandlerError {
+		if req.RequestLine.RequestTarget == "/unframed" {
+			w.WriteStatusLine(response.Code200)
+			w.WriteHeaders(headers.NewHeaders())
+			w.WriteBody([]byte("until close"))
+			return nil
+		}
+		w.Write([]byte("path " + req.RequestLine.RequestTarget))
+		return nil
+	})
+	addr := startServer(t, s)
+
+	// Test: Pipelined requests are answered in order on one connection
+	conn, br := dial(t, addr)
+	_, err := io.WriteString(conn, "GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"POST /two HTTP/1.1\r\nHost: localhost\r\nContent-Length: 4\r\n\r\nbody"+
+		"GET /three HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	for _, want := range []string{"path /one", "path /two", "path /three"} {
+		res, body := readResponse(t, br)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, want, body)
+		assert.False(t, res.Close)
+	}
+
+	// Test: Connection: close ends the connection after the response
+	_, err = io.WriteString(conn, "GET /last HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"+
+		"GET /ignored HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	res, body := readResponse(t, br)
+	assert.Equal(t, "path /last", body)
+	assert.True(t, res.Close)
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: A response without framing is ended by closing the connection
+	conn, br = dial(t, addr)
+	_, err = io.WriteString(conn, "GET /unframed HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	res, body = readResponse(t, br)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "until close", body)
+}
+
+// slowReader yields one chunk per interval.
+type slowReader struct {
+	chunks   []string
+	interval time.Duration
+}
+
+func (sr *slowReader) Read(p []byte) (int, error) {
+	if len(sr.chunks) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(sr.interval)
+	n := copy(p, sr.chunks[0])
+	sr.chunks = sr.chunks[1:]
+	return n, nil
+}
+
+func TestStreamOutlivesWriteTimeout(t *testing.T) {
+	s := New(func(w *response.Writer, req *request.Request) *HandlerError {
+		_, err := w.Stream(&slowReader{chunks: []string{"a", "b", "c", "d", "e", "f"}, interval: 50 * time.Millisecond}, 0)
+		if err != nil {
+			t.Errorf("stream: %s", err)
+		}
+		return nil
+	})
+	s.WriteTimeout = 120 * time.Millisecond
+	addr := startServer(t, s)
+
+	// Test: Each chunk gets the full WriteTimeout
+	conn, br := dial(t, addr)
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	res, body := readResponse(t, br)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "abcdef", body)
+}
+
+func TestUnreadBody(t *testing.T) {
+	s := New(func(w *response.Writer, req *request.Request) *HandlerError {
+		w.Write([]byte("ignored"))
+		return nil
+	})
+	s.StreamRequestBody = true
+	addr := startServer(t, s)
+
+	// Test: A small unread body is drained and the connection reused
+	conn, br := dial(t, addr)
+	_, err := io.WriteString(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 4\r\n\r\nbody"+
+		"GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	for range 2 {
+		res, body := readResponse(t, br)
+		assert.Equal(t, "ignored", body)
+		assert.False(t, res.Close)
+	}
+
+	// Test: A body too large to drain closes the connection, and the
+	// response says so
+	conn, br = dial(t, addr)
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 1048576\r\n\r\npartial")
+	require.NoError(t, err)
+	res, body := readResponse(t, br)
+	assert.Equal(t, "ignored", body)
+	assert.True(t, res.Close)
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}